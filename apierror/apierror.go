@@ -0,0 +1,160 @@
+// Package apierror define el formato común de las respuestas de error:
+// {code, message, details, requestId}.
+package apierror
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// RequestIDHeader es la cabecera con el identificador de la petición. El
+// middleware RequestID la fija en la respuesta antes de ejecutar el
+// handler, de modo que los errores pueden incluirla sin recibir el request.
+const RequestIDHeader = "X-Request-ID"
+
+// Códigos de error. Los no listados se derivan del estado HTTP con CodeFor.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeUnauthorized        = "unauthorized"
+	CodePaymentRequired     = "payment_required"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeConflict            = "conflict"
+	CodePreconditionFailed  = "precondition_failed"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeUnprocessable       = "unprocessable_entity"
+	CodeInternal            = "internal_error"
+	CodeDuplicate           = "duplicate"
+	CodeForeignKeyViolation = "foreign_key_violation"
+	CodeValidation          = "validation_failed"
+)
+
+// Body es el cuerpo JSON de una respuesta de error.
+type Body struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusPaymentRequired:       CodePaymentRequired,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+}
+
+// CodeFor devuelve el código genérico de un estado HTTP.
+func CodeFor(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Write envía un error con código y detalles explícitos.
+func Write(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Body{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: w.Header().Get(RequestIDHeader),
+	})
+}
+
+// Error sustituye a http.Error: mismo orden de argumentos, con el código
+// derivado del estado.
+func Error(w http.ResponseWriter, message string, status int) {
+	Write(w, status, CodeFor(status), message, nil)
+}
+
+// Internal responde a un error inesperado. Los errores conocidos de MySQL
+// se traducen a 409 o 422; el resto se registra en el log y el cliente solo
+// recibe un mensaje genérico con el requestId para poder rastrearlo.
+func Internal(w http.ResponseWriter, err error) {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062: // ER_DUP_ENTRY
+			Write(w, http.StatusConflict, CodeDuplicate, "Ya existe un registro con esos datos",
+				map[string]string{"key": duplicateKey(mysqlErr.Message)})
+			return
+		case 1451, 1452: // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2
+			Write(w, http.StatusUnprocessableEntity, CodeForeignKeyViolation,
+				"La operación hace referencia a un registro inexistente o en uso", nil)
+			return
+		}
+	}
+
+	log.Printf("❌ Error interno [%s]: %v", w.Header().Get(RequestIDHeader), err)
+	Write(w, http.StatusInternalServerError, CodeInternal, "Error interno del servidor", nil)
+}
+
+// duplicateKey extrae el índice violado de un mensaje "Duplicate entry
+// '...' for key 'users.name'" sin el nombre de la tabla.
+func duplicateKey(message string) string {
+	i := strings.LastIndex(message, "for key '")
+	if i < 0 {
+		return ""
+	}
+	key := strings.TrimSuffix(message[i+len("for key '"):], "'")
+	if dot := strings.LastIndex(key, "."); dot >= 0 {
+		key = key[dot+1:]
+	}
+	return key
+}
+
+// Status responde err con el estado indicado. Los estados 5xx pasan por
+// Internal para no exponer el detalle al cliente.
+func Status(w http.ResponseWriter, err error, status int) {
+	if status >= http.StatusInternalServerError {
+		Internal(w, err)
+		return
+	}
+	Error(w, err.Error(), status)
+}
+
+// RequestID asigna un identificador a cada petición, respetando el que
+// envíe el cliente, y lo devuelve en la cabecera X-Request-ID.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			raw := make([]byte, 8)
+			rand.Read(raw)
+			id = hex.EncodeToString(raw)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NotFound y MethodNotAllowed sustituyen las respuestas en texto plano del
+// router.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, "Recurso no encontrado", http.StatusNotFound)
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,266 @@
+package dispatch
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"deliveryService/geo"
+	"deliveryService/models"
+	"deliveryService/money"
+	"deliveryService/sse"
+	"deliveryService/zones"
+)
+
+type offer struct {
+	courierId int
+	expiresAt time.Time
+}
+
+// Engine empareja periódicamente órdenes pendientes con repartidores
+// conectados. Cada orden se ofrece a un único repartidor a la vez; si la
+// rechaza o la oferta expira, pasa al siguiente candidato.
+type Engine struct {
+	DB           *sql.DB
+	SSEManager   *sse.SSEManager
+	Strategy     Strategy
+	Interval     time.Duration
+	OfferTimeout time.Duration
+
+	mu     sync.Mutex
+	offers map[int]*offer       // orderId -> oferta vigente
+	tried  map[int]map[int]bool // orderId -> repartidores que ya la rechazaron o dejaron expirar
+}
+
+func NewEngine(db *sql.DB, sseManager *sse.SSEManager, strategy Strategy, interval, offerTimeout time.Duration) *Engine {
+	return &Engine{
+		DB:           db,
+		SSEManager:   sseManager,
+		Strategy:     strategy,
+		Interval:     interval,
+		OfferTimeout: offerTimeout,
+		offers:       make(map[int]*offer),
+		tried:        make(map[int]map[int]bool),
+	}
+}
+
+func (e *Engine) Start() {
+	go func() {
+		ticker := time.NewTicker(e.Interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			e.Run()
+		}
+	}()
+}
+
+// Accept consume la oferta vigente de la orden si pertenece al repartidor.
+func (e *Engine) Accept(orderId, courierId int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, exists := e.offers[orderId]
+	if !exists || o.courierId != courierId || time.Now().After(o.expiresAt) {
+		return false
+	}
+	delete(e.offers, orderId)
+	delete(e.tried, orderId)
+	return true
+}
+
+// Decline descarta la oferta; la orden se ofrecerá a otro repartidor en la
+// siguiente ronda.
+func (e *Engine) Decline(orderId, courierId int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, exists := e.offers[orderId]
+	if !exists || o.courierId != courierId {
+		return false
+	}
+	delete(e.offers, orderId)
+	e.markTried(orderId, courierId)
+	return true
+}
+
+func (e *Engine) markTried(orderId, courierId int) {
+	if e.tried[orderId] == nil {
+		e.tried[orderId] = make(map[int]bool)
+	}
+	e.tried[orderId][courierId] = true
+}
+
+// Run ejecuta una ronda de despacho.
+func (e *Engine) Run() {
+	jobs, payloads, err := e.pendingJobs()
+	if err != nil {
+		log.Printf("Dispatch: error obteniendo órdenes pendientes: %v", err)
+		return
+	}
+	couriers, err := e.availableCouriers()
+	if err != nil {
+		log.Printf("Dispatch: error obteniendo repartidores: %v", err)
+		return
+	}
+	activeZones, err := zones.LoadActive(e.DB)
+	if err != nil {
+		log.Printf("Dispatch: error obteniendo zonas: %v", err)
+		return
+	}
+	zoneById := make(map[int]models.Zone, len(activeZones))
+	for _, z := range activeZones {
+		zoneById[z.ID] = z
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	pending := make(map[int]bool, len(jobs))
+	for _, job := range jobs {
+		pending[job.OrderID] = true
+	}
+
+	// Retirar ofertas expiradas o de órdenes que ya no están pendientes
+	busy := make(map[int]bool)
+	for orderId, o := range e.offers {
+		switch {
+		case !pending[orderId]:
+			delete(e.offers, orderId)
+			e.SSEManager.NotifyUser(o.courierId, "offer_withdrawn", map[string]int{"orderId": orderId})
+		case now.After(o.expiresAt):
+			delete(e.offers, orderId)
+			e.markTried(orderId, o.courierId)
+			e.SSEManager.NotifyUser(o.courierId, "offer_expired", map[string]int{"orderId": orderId})
+		default:
+			busy[o.courierId] = true
+		}
+	}
+	for orderId := range e.tried {
+		if !pending[orderId] {
+			delete(e.tried, orderId)
+		}
+	}
+
+	for _, job := range jobs {
+		if _, offered := e.offers[job.OrderID]; offered {
+			continue
+		}
+
+		var candidates []Courier
+		for _, c := range couriers {
+			if busy[c.ID] || e.tried[job.OrderID][c.ID] {
+				continue
+			}
+			// Si se conoce su posición, el repartidor debe estar en la zona de la orden
+			if job.ZoneID != nil && c.Location != nil {
+				if zone, ok := zoneById[*job.ZoneID]; ok && !zone.Contains(*c.Location) {
+					continue
+				}
+			}
+			candidates = append(candidates, c)
+		}
+		if len(candidates) == 0 {
+			// Todos la rechazaron: volver a empezar en la siguiente ronda
+			if len(e.tried[job.OrderID]) >= len(couriers) {
+				delete(e.tried, job.OrderID)
+			}
+			continue
+		}
+
+		chosen := e.Strategy.Rank(job, candidates)[0]
+		expiresAt := now.Add(e.OfferTimeout)
+		e.offers[job.OrderID] = &offer{courierId: chosen.ID, expiresAt: expiresAt}
+		busy[chosen.ID] = true
+
+		e.SSEManager.NotifyUser(chosen.ID, "order_offer", map[string]interface{}{
+			"order":     payloads[job.OrderID],
+			"expiresAt": expiresAt,
+		})
+		log.Printf("Dispatch: orden %d ofrecida al repartidor %d", job.OrderID, chosen.ID)
+	}
+}
+
+type jobPayload struct {
+	ID                int          `json:"id"`
+	Title             string       `json:"title"`
+	EstablishmentName string       `json:"establishmentName"`
+	EstablishmentAddr string       `json:"establishmentAddress"`
+	Price             money.Amount `json:"price"`
+}
+
+func (e *Engine) pendingJobs() ([]Job, map[int]jobPayload, error) {
+	rows, err := e.DB.Query(`
+		SELECT id, title, establishmentName, establishmentAddress, price,
+			establishment_lat, establishment_lng, zone_id
+		FROM orders WHERE status = 'pending' AND delivery_id IS NULL AND deleted_at IS NULL
+		ORDER BY created_at ASC, id ASC`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	payloads := make(map[int]jobPayload)
+	for rows.Next() {
+		var p jobPayload
+		var lat, lng sql.NullFloat64
+		var zoneId sql.NullInt64
+		err := rows.Scan(&p.ID, &p.Title, &p.EstablishmentName, &p.EstablishmentAddr, &p.Price, &lat, &lng, &zoneId)
+		if err != nil {
+			return nil, nil, err
+		}
+		job := Job{OrderID: p.ID}
+		if zoneId.Valid {
+			id := int(zoneId.Int64)
+			job.ZoneID = &id
+		}
+		if lat.Valid && lng.Valid {
+			job.Pickup = &geo.Point{Lat: lat.Float64, Lng: lng.Float64}
+		}
+		jobs = append(jobs, job)
+		payloads[p.ID] = p
+	}
+	return jobs, payloads, rows.Err()
+}
+
+// availableCouriers devuelve los repartidores en línea, conectados por SSE
+// y con capacidad libre, junto con su número de órdenes activas y su
+// valoración media.
+func (e *Engine) availableCouriers() ([]Courier, error) {
+	rows, err := e.DB.Query(`
+		SELECT u.id, COUNT(o.id), l.lat, l.lng,
+			(SELECT AVG(r.courier_rating) FROM reviews r WHERE r.courier_id = u.id)
+		FROM users u
+		LEFT JOIN orders o ON o.delivery_id = u.id AND o.status NOT IN ('delivered', 'cancelled') AND o.deleted_at IS NULL
+		LEFT JOIN courier_locations l ON l.courier_id = u.id
+		WHERE u.role = 'delivery' AND u.deleted_at IS NULL AND u.availability = 'online'
+		GROUP BY u.id, u.max_active_orders, l.lat, l.lng
+		HAVING COUNT(o.id) < u.max_active_orders`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var couriers []Courier
+	for rows.Next() {
+		var c Courier
+		var lat, lng, rating sql.NullFloat64
+		if err := rows.Scan(&c.ID, &c.ActiveOrders, &lat, &lng, &rating); err != nil {
+			return nil, err
+		}
+		c.Rating = NeutralRating
+		if rating.Valid {
+			c.Rating = rating.Float64
+		}
+		if lat.Valid && lng.Valid {
+			c.Location = &geo.Point{Lat: lat.Float64, Lng: lng.Float64}
+		}
+		if e.SSEManager.IsConnected(c.ID) {
+			couriers = append(couriers, c)
+		}
+	}
+	return couriers, rows.Err()
+}
@@ -0,0 +1,45 @@
+package dispatch
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"deliveryService/sse"
+)
+
+// PresenceWatcher pasa a "offline" a los repartidores cuya conexión SSE
+// lleva caída más tiempo que Grace.
+type PresenceWatcher struct {
+	DB         *sql.DB
+	SSEManager *sse.SSEManager
+	Grace      time.Duration
+}
+
+func (p *PresenceWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(p.Grace / 2)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for _, userId := range p.SSEManager.ExpiredDisconnections(p.Grace) {
+				p.setOffline(userId)
+			}
+		}
+	}()
+}
+
+func (p *PresenceWatcher) setOffline(userId int) {
+	result, err := p.DB.Exec(
+		`UPDATE users SET availability = 'offline', availability_updated_at = ?
+		 WHERE id = ? AND role = 'delivery' AND availability <> 'offline'`,
+		time.Now(), userId,
+	)
+	if err != nil {
+		log.Printf("Error marcando offline al repartidor %d: %v", userId, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Repartidor %d marcado offline por desconexión", userId)
+	}
+}
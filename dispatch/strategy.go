@@ -0,0 +1,126 @@
+package dispatch
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"deliveryService/geo"
+)
+
+// Courier es un repartidor candidato a recibir una oferta. Rating es su
+// valoración media; los repartidores sin valoraciones reciben NeutralRating.
+type Courier struct {
+	ID           int
+	ActiveOrders int
+	Location     *geo.Point
+	Rating       float64
+}
+
+// NeutralRating es la valoración asumida para quien aún no tiene ninguna,
+// para no penalizar a los repartidores nuevos.
+const NeutralRating = 3.0
+
+// Job es una orden pendiente de asignar. Pickup es la ubicación del
+// establecimiento y ZoneID su zona de cobertura, si se conocen.
+type Job struct {
+	OrderID int
+	Pickup  *geo.Point
+	ZoneID  *int
+}
+
+// Strategy ordena los candidatos de mejor a peor para una orden.
+type Strategy interface {
+	Rank(job Job, couriers []Courier) []Courier
+}
+
+func NewStrategy(name string) (Strategy, bool) {
+	switch name {
+	case "round_robin":
+		return &RoundRobin{}, true
+	case "least_loaded":
+		return LeastLoaded{}, true
+	case "nearest":
+		return Nearest{}, true
+	case "best_rated":
+		return BestRated{}, true
+	}
+	return nil, false
+}
+
+// RoundRobin reparte las ofertas rotando entre los repartidores por id.
+type RoundRobin struct {
+	mu   sync.Mutex
+	last int
+}
+
+func (s *RoundRobin) Rank(job Job, couriers []Courier) []Courier {
+	ranked := append([]Courier{}, couriers...)
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].ID < ranked[j].ID })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Empezar por el primer id mayor que el último elegido
+	start := 0
+	for start < len(ranked) && ranked[start].ID <= s.last {
+		start++
+	}
+	ranked = append(ranked[start:], ranked[:start]...)
+	if len(ranked) > 0 {
+		s.last = ranked[0].ID
+	}
+	return ranked
+}
+
+// LeastLoaded prioriza a los repartidores con menos órdenes activas; a
+// igual carga, al mejor valorado.
+type LeastLoaded struct{}
+
+func (LeastLoaded) Rank(job Job, couriers []Courier) []Courier {
+	ranked := append([]Courier{}, couriers...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].ActiveOrders != ranked[j].ActiveOrders {
+			return ranked[i].ActiveOrders < ranked[j].ActiveOrders
+		}
+		if ranked[i].Rating != ranked[j].Rating {
+			return ranked[i].Rating > ranked[j].Rating
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked
+}
+
+// BestRated prioriza a los repartidores mejor valorados; a igual
+// valoración, por carga.
+type BestRated struct{}
+
+func (BestRated) Rank(job Job, couriers []Courier) []Courier {
+	ranked := LeastLoaded{}.Rank(job, couriers)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Rating > ranked[j].Rating
+	})
+	return ranked
+}
+
+// Nearest prioriza al repartidor más cercano al establecimiento. Los
+// repartidores sin ubicación conocida quedan al final, por carga.
+type Nearest struct{}
+
+func (Nearest) Rank(job Job, couriers []Courier) []Courier {
+	ranked := LeastLoaded{}.Rank(job, couriers)
+	if job.Pickup == nil {
+		return ranked
+	}
+
+	distance := func(c Courier) float64 {
+		if c.Location == nil {
+			return math.Inf(1)
+		}
+		return geo.DistanceKm(*c.Location, *job.Pickup)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return distance(ranked[i]) < distance(ranked[j])
+	})
+	return ranked
+}
@@ -0,0 +1,96 @@
+package dispatch
+
+import (
+	"reflect"
+	"testing"
+
+	"deliveryService/geo"
+)
+
+func point(lat, lng float64) *geo.Point {
+	return &geo.Point{Lat: lat, Lng: lng}
+}
+
+func courierIDs(couriers []Courier) []int {
+	ids := make([]int, len(couriers))
+	for i, c := range couriers {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// El establecimiento está en (0, 0); el repartidor 3 no tiene ubicación.
+var testCouriers = []Courier{
+	{ID: 1, ActiveOrders: 2, Rating: 4.5, Location: point(0, 0.05)},
+	{ID: 2, ActiveOrders: 0, Rating: 4.0, Location: point(0, 0.01)},
+	{ID: 3, ActiveOrders: 0, Rating: 4.8},
+	{ID: 4, ActiveOrders: 1, Rating: 4.8, Location: point(0, 0.02)},
+}
+
+func TestRank(t *testing.T) {
+	job := Job{OrderID: 10, Pickup: point(0, 0)}
+	tied := []Courier{
+		{ID: 7, ActiveOrders: 1, Rating: NeutralRating, Location: point(0, 0.01)},
+		{ID: 5, ActiveOrders: 1, Rating: NeutralRating, Location: point(0, 0.01)},
+		{ID: 6, ActiveOrders: 0, Rating: NeutralRating, Location: point(0, 0.01)},
+	}
+
+	tests := []struct {
+		name     string
+		strategy Strategy
+		job      Job
+		couriers []Courier
+		want     []int
+	}{
+		{"least_loaded: carga y después valoración", LeastLoaded{}, job, testCouriers, []int{3, 2, 4, 1}},
+		{"least_loaded: empate completo por id", LeastLoaded{}, job, tied, []int{6, 5, 7}},
+		{"best_rated: valoración y después carga", BestRated{}, job, testCouriers, []int{3, 4, 1, 2}},
+		{"best_rated: empate completo por carga e id", BestRated{}, job, tied, []int{6, 5, 7}},
+		{"nearest: sin ubicación al final", Nearest{}, job, testCouriers, []int{2, 4, 1, 3}},
+		{"nearest: a igual distancia por carga e id", Nearest{}, job, tied, []int{6, 5, 7}},
+		{"nearest: sin recogida conocida por carga", Nearest{}, Job{OrderID: 10}, testCouriers, []int{3, 2, 4, 1}},
+		{"sin candidatos", LeastLoaded{}, job, []Courier{}, []int{}},
+	}
+	for _, tt := range tests {
+		input := append([]Courier{}, tt.couriers...)
+		got := courierIDs(tt.strategy.Rank(tt.job, input))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Rank = %v, want %v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(input, tt.couriers) {
+			t.Errorf("%s: Rank modificó la lista recibida", tt.name)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	s := &RoundRobin{}
+	couriers := []Courier{{ID: 3}, {ID: 1}, {ID: 2}}
+
+	rounds := [][]int{{1, 2, 3}, {2, 3, 1}, {3, 1, 2}, {1, 2, 3}}
+	for i, want := range rounds {
+		if got := courierIDs(s.Rank(Job{}, couriers)); !reflect.DeepEqual(got, want) {
+			t.Errorf("ronda %d: Rank = %v, want %v", i+1, got, want)
+		}
+	}
+
+	// Sigue por el siguiente id aunque el último elegido ya no esté
+	s.Rank(Job{}, couriers)
+	if got := courierIDs(s.Rank(Job{}, []Courier{{ID: 1}, {ID: 4}, {ID: 3}})); !reflect.DeepEqual(got, []int{3, 4, 1}) {
+		t.Errorf("tras quitar al repartidor 2: Rank = %v, want [3 4 1]", got)
+	}
+	if got := s.Rank(Job{}, nil); len(got) != 0 {
+		t.Errorf("sin candidatos: Rank = %v", got)
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range []string{"round_robin", "least_loaded", "nearest", "best_rated"} {
+		if s, ok := NewStrategy(name); !ok || s == nil {
+			t.Errorf("NewStrategy(%q) no devolvió una estrategia", name)
+		}
+	}
+	if _, ok := NewStrategy("random"); ok {
+		t.Error("NewStrategy aceptó una estrategia desconocida")
+	}
+}
@@ -0,0 +1,34 @@
+package earnings
+
+import (
+	"math"
+
+	"deliveryService/money"
+)
+
+// Config define lo que gana el repartidor por orden entregada.
+type Config struct {
+	BaseFee  money.Amount // pago fijo por entrega
+	PerKmFee money.Amount // pago por kilómetro entre establecimiento y destino
+}
+
+// Breakdown es la ganancia de una entrega por componente.
+type Breakdown struct {
+	BaseFee     money.Amount
+	DistanceFee money.Amount
+	DistanceKm  float64
+	Tip         money.Amount
+	Total       money.Amount
+}
+
+// Compute calcula la ganancia; sin distancia conocida solo se paga la base.
+// La propina se transfiere íntegra al repartidor.
+func (c Config) Compute(distanceKm *float64, tip money.Amount) Breakdown {
+	b := Breakdown{BaseFee: c.BaseFee, Tip: tip}
+	if distanceKm != nil {
+		b.DistanceKm = math.Round(*distanceKm*100) / 100
+		b.DistanceFee = money.Amount(math.Round(float64(c.PerKmFee) * *distanceKm))
+	}
+	b.Total = b.BaseFee + b.DistanceFee + b.Tip
+	return b
+}
@@ -0,0 +1,31 @@
+package earnings
+
+import (
+	"testing"
+
+	"deliveryService/money"
+)
+
+func TestCompute(t *testing.T) {
+	cfg := Config{BaseFee: 3000, PerKmFee: 800}
+	km := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name       string
+		distanceKm *float64
+		tip        money.Amount
+		want       Breakdown
+	}{
+		{"sin distancia", nil, 0, Breakdown{BaseFee: 3000, Total: 3000}},
+		{"con distancia", km(2.5), 0, Breakdown{BaseFee: 3000, DistanceFee: 2000, DistanceKm: 2.5, Total: 5000}},
+		// 3.456 km * 8.00 = 27.648, se redondea al centavo; los km a dos decimales
+		{"redondeo", km(3.456), 0, Breakdown{BaseFee: 3000, DistanceFee: 2765, DistanceKm: 3.46, Total: 5765}},
+		{"con propina", km(1), 1500, Breakdown{BaseFee: 3000, DistanceFee: 800, DistanceKm: 1, Tip: 1500, Total: 5300}},
+		{"propina sin distancia", nil, 1000, Breakdown{BaseFee: 3000, Tip: 1000, Total: 4000}},
+	}
+	for _, tt := range tests {
+		if got := cfg.Compute(tt.distanceKm, tt.tip); got != tt.want {
+			t.Errorf("%s:\n got  %+v\n want %+v", tt.name, got, tt.want)
+		}
+	}
+}
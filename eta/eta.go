@@ -0,0 +1,69 @@
+package eta
+
+import (
+	"time"
+
+	"deliveryService/geo"
+)
+
+// Config agrupa los supuestos del cálculo.
+type Config struct {
+	SpeedKmh   float64       // velocidad media del repartidor
+	PrepTime   time.Duration // preparación en el establecimiento desde la creación
+	DefaultLeg time.Duration // duración de un tramo cuando faltan coordenadas
+}
+
+// Input es el estado de la orden relevante para la estimación.
+type Input struct {
+	Status        string
+	CreatedAt     time.Time
+	Courier       *geo.Point
+	Establishment *geo.Point
+	Destination   *geo.Point
+}
+
+// Estimate contiene las horas estimadas; nil cuando la etapa ya ocurrió.
+type Estimate struct {
+	PickupAt   *time.Time
+	DeliveryAt *time.Time
+}
+
+// Travel estima la duración de un tramo en línea recta.
+func (c Config) Travel(from, to *geo.Point) time.Duration {
+	if from == nil || to == nil || c.SpeedKmh <= 0 {
+		return c.DefaultLeg
+	}
+	hours := geo.DistanceKm(*from, *to) / c.SpeedKmh
+	return time.Duration(hours * float64(time.Hour))
+}
+
+func (c Config) Estimate(in Input, now time.Time) Estimate {
+	var est Estimate
+
+	switch in.Status {
+	case "pending", "pickup":
+		// El pedido se recoge cuando está listo y el repartidor ha llegado
+		pickup := in.CreatedAt.Add(c.PrepTime)
+		if pickup.Before(now) {
+			pickup = now
+		}
+		if in.Courier != nil {
+			if arrival := now.Add(c.Travel(in.Courier, in.Establishment)); arrival.After(pickup) {
+				pickup = arrival
+			}
+		}
+		delivery := pickup.Add(c.Travel(in.Establishment, in.Destination))
+		est.PickupAt, est.DeliveryAt = &pickup, &delivery
+	case "in_coming":
+		from := in.Courier
+		if from == nil {
+			from = in.Establishment
+		}
+		delivery := now.Add(c.Travel(from, in.Destination))
+		est.DeliveryAt = &delivery
+	case "arrived":
+		est.DeliveryAt = &now
+	}
+
+	return est
+}
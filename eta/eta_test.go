@@ -0,0 +1,115 @@
+package eta
+
+import (
+	"testing"
+	"time"
+
+	"deliveryService/geo"
+)
+
+func TestEstimate(t *testing.T) {
+	establishment := &geo.Point{Lat: 0, Lng: 0}
+	destination := &geo.Point{Lat: 0.1, Lng: 0}
+	halfway := &geo.Point{Lat: 0.05, Lng: 0}
+	behind := &geo.Point{Lat: -0.05, Lng: 0}
+
+	// Con esta velocidad el tramo establecimiento-destino dura justo una hora
+	cfg := Config{
+		SpeedKmh:   geo.DistanceKm(*establishment, *destination),
+		PrepTime:   15 * time.Minute,
+		DefaultLeg: 20 * time.Minute,
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-5 * time.Minute)
+	at := func(minutes int) *time.Time {
+		t := now.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+
+	tests := []struct {
+		name       string
+		in         Input
+		pickupAt   *time.Time
+		deliveryAt *time.Time
+	}{
+		{
+			"pendiente: se recoge al terminar la preparación",
+			Input{Status: "pending", CreatedAt: created, Establishment: establishment, Destination: destination},
+			at(10), at(70),
+		},
+		{
+			"preparación ya cumplida: se recoge ahora",
+			Input{Status: "pending", CreatedAt: now.Add(-time.Hour), Establishment: establishment, Destination: destination},
+			at(0), at(60),
+		},
+		{
+			"el repartidor llega después de la preparación",
+			Input{Status: "pickup", CreatedAt: created, Courier: behind, Establishment: establishment, Destination: destination},
+			at(30), at(90),
+		},
+		{
+			"el repartidor ya espera en el establecimiento",
+			Input{Status: "pickup", CreatedAt: created, Courier: establishment, Establishment: establishment, Destination: destination},
+			at(10), at(70),
+		},
+		{
+			"sin destino se usa el tramo por defecto",
+			Input{Status: "pending", CreatedAt: created, Establishment: establishment},
+			at(10), at(30),
+		},
+		{
+			"en camino desde la posición del repartidor",
+			Input{Status: "in_coming", CreatedAt: created, Courier: halfway, Establishment: establishment, Destination: destination},
+			nil, at(30),
+		},
+		{
+			"en camino sin posición: desde el establecimiento",
+			Input{Status: "in_coming", CreatedAt: created, Establishment: establishment, Destination: destination},
+			nil, at(60),
+		},
+		{"en la puerta", Input{Status: "arrived", CreatedAt: created}, nil, at(0)},
+		{"entregada", Input{Status: "delivered", CreatedAt: created}, nil, nil},
+		{"cancelada", Input{Status: "cancelled", CreatedAt: created}, nil, nil},
+	}
+	for _, tt := range tests {
+		est := cfg.Estimate(tt.in, now)
+		if !sameTime(est.PickupAt, tt.pickupAt) {
+			t.Errorf("%s: PickupAt = %v, want %v", tt.name, est.PickupAt, tt.pickupAt)
+		}
+		if !sameTime(est.DeliveryAt, tt.deliveryAt) {
+			t.Errorf("%s: DeliveryAt = %v, want %v", tt.name, est.DeliveryAt, tt.deliveryAt)
+		}
+	}
+}
+
+func TestTravel(t *testing.T) {
+	from, to := &geo.Point{Lat: 0, Lng: 0}, &geo.Point{Lat: 0, Lng: 0.1}
+	km := geo.DistanceKm(*from, *to)
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		from, to *geo.Point
+		want     time.Duration
+	}{
+		{"a la velocidad media", Config{SpeedKmh: km * 2}, from, to, 30 * time.Minute},
+		{"sin origen", Config{SpeedKmh: 25, DefaultLeg: 20 * time.Minute}, nil, to, 20 * time.Minute},
+		{"sin destino", Config{SpeedKmh: 25, DefaultLeg: 20 * time.Minute}, from, nil, 20 * time.Minute},
+		{"sin velocidad", Config{DefaultLeg: 20 * time.Minute}, from, to, 20 * time.Minute},
+		{"mismo punto", Config{SpeedKmh: 25}, from, from, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.Travel(tt.from, tt.to); (got - tt.want).Abs() > time.Second {
+			t.Errorf("%s: Travel = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// sameTime compara con un margen de un segundo por el redondeo de las
+// distancias.
+func sameTime(got, want *time.Time) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return got.Sub(*want).Abs() <= time.Second
+}
@@ -0,0 +1,37 @@
+package geo
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+type Point struct {
+	Lat float64 `json:"lat" validate:"min=-90,max=90"`
+	Lng float64 `json:"lng" validate:"min=-180,max=180"`
+}
+
+// DistanceKm calcula la distancia en línea recta (fórmula de haversine)
+// entre dos puntos.
+func DistanceKm(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// InPolygon indica si p está dentro del polígono (algoritmo de ray casting).
+// Los vértices se interpretan en orden y el polígono se cierra solo.
+func InPolygon(p Point, polygon []Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
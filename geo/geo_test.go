@@ -0,0 +1,52 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{"mismo punto", Point{19.43, -99.13}, Point{19.43, -99.13}, 0},
+		{"un grado de latitud", Point{0, 0}, Point{1, 0}, 111.19},
+		{"un grado de longitud en el ecuador", Point{0, 0}, Point{0, 1}, 111.19},
+		{"CDMX a Guadalajara", Point{19.4326, -99.1332}, Point{20.6597, -103.3496}, 461.5},
+	}
+	for _, tt := range tests {
+		if got := DistanceKm(tt.a, tt.b); math.Abs(got-tt.want) > 0.5 {
+			t.Errorf("%s: DistanceKm = %.2f, want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInPolygon(t *testing.T) {
+	square := []Point{{0, 0}, {0, 10}, {10, 10}, {10, 0}}
+	// Forma de L: el cuadrante superior derecho queda fuera
+	lShape := []Point{{0, 0}, {0, 10}, {5, 10}, {5, 5}, {10, 5}, {10, 0}}
+
+	tests := []struct {
+		name    string
+		p       Point
+		polygon []Point
+		want    bool
+	}{
+		{"centro del cuadrado", Point{5, 5}, square, true},
+		{"cerca de un vértice", Point{0.1, 9.9}, square, true},
+		{"fuera por arriba", Point{11, 5}, square, false},
+		{"fuera por la izquierda", Point{5, -0.1}, square, false},
+		{"brazo inferior de la L", Point{2, 8}, lShape, true},
+		{"brazo lateral de la L", Point{8, 2}, lShape, true},
+		{"hueco de la L", Point{8, 8}, lShape, false},
+		{"polígono vacío", Point{0, 0}, nil, false},
+		{"polígono degenerado", Point{0, 0}, []Point{{0, 0}, {1, 1}}, false},
+	}
+	for _, tt := range tests {
+		if got := InPolygon(tt.p, tt.polygon); got != tt.want {
+			t.Errorf("%s: InPolygon(%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package geocoding
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"deliveryService/geo"
+	"deliveryService/models"
+)
+
+var ErrNotFound = errors.New("dirección no encontrada")
+
+// Geocoder resuelve una dirección estructurada a coordenadas.
+type Geocoder interface {
+	Geocode(address models.Address) (geo.Point, error)
+}
+
+// StaticGeocoder resuelve direcciones contra una tabla fija, sin acceso a
+// red. Busca primero por calle y ciudad y, si no hay coincidencia, usa el
+// centroide del código postal.
+type StaticGeocoder struct {
+	Streets     map[string]geo.Point // clave: Key(street, city)
+	PostalCodes map[string]geo.Point
+}
+
+func Key(street, city string) string {
+	return normalize(street) + "|" + normalize(city)
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+func (g *StaticGeocoder) Geocode(address models.Address) (geo.Point, error) {
+	if p, ok := g.Streets[Key(address.Street, address.City)]; ok {
+		return p, nil
+	}
+	if p, ok := g.PostalCodes[normalize(address.PostalCode)]; ok && address.PostalCode != "" {
+		return p, nil
+	}
+	return geo.Point{}, ErrNotFound
+}
+
+// LoadStaticGeocoder lee la tabla desde un archivo JSON con la forma
+// {"streets": [{"street", "city", "lat", "lng"}], "postalCodes": {"29000": {"lat", "lng"}}}.
+func LoadStaticGeocoder(path string) (*StaticGeocoder, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table struct {
+		Streets []struct {
+			Street string  `json:"street"`
+			City   string  `json:"city"`
+			Lat    float64 `json:"lat"`
+			Lng    float64 `json:"lng"`
+		} `json:"streets"`
+		PostalCodes map[string]geo.Point `json:"postalCodes"`
+	}
+	if err := json.Unmarshal(raw, &table); err != nil {
+		return nil, err
+	}
+
+	g := &StaticGeocoder{
+		Streets:     make(map[string]geo.Point),
+		PostalCodes: make(map[string]geo.Point),
+	}
+	for _, s := range table.Streets {
+		g.Streets[Key(s.Street, s.City)] = geo.Point{Lat: s.Lat, Lng: s.Lng}
+	}
+	for code, p := range table.PostalCodes {
+		g.PostalCodes[normalize(code)] = p
+	}
+	return g, nil
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"deliveryService/geocoding"
+	"deliveryService/models"
+)
+
+var postalCodePattern = regexp.MustCompile(`^[A-Za-z0-9 -]{3,10}$`)
+
+// resolveAddress valida la dirección y, si no trae coordenadas, las obtiene
+// del geocodificador. Devuelve geocoding.ErrNotFound si no se pudo ubicar.
+func resolveAddress(g geocoding.Geocoder, a *models.Address) error {
+	a.Street = strings.TrimSpace(a.Street)
+	a.City = strings.TrimSpace(a.City)
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+
+	if a.Street == "" || a.City == "" {
+		return errors.New("La dirección requiere calle y ciudad")
+	}
+	if len(a.Street) > 255 || len(a.City) > 120 || len(a.Notes) > 255 {
+		return errors.New("La dirección excede la longitud permitida")
+	}
+	if a.PostalCode != "" && !postalCodePattern.MatchString(a.PostalCode) {
+		return errors.New("Código postal inválido")
+	}
+
+	if a.Location != nil {
+		if a.Location.Lat < -90 || a.Location.Lat > 90 || a.Location.Lng < -180 || a.Location.Lng > 180 {
+			return errors.New("Coordenadas fuera de rango")
+		}
+		return nil
+	}
+
+	point, err := g.Geocode(*a)
+	if err != nil {
+		return err
+	}
+	a.Location = &point
+	return nil
+}
+
+// addressStatus elige el código HTTP para un error de resolveAddress.
+func addressStatus(err error) int {
+	if err == geocoding.ErrNotFound {
+		return 422
+	}
+	return 400
+}
+
+// addressArgs devuelve street, city, postal code, notes, lat, lng para
+// INSERT/UPDATE; todos NULL si no hay dirección estructurada.
+func addressArgs(a *models.Address) []interface{} {
+	if a == nil {
+		return []interface{}{nil, nil, nil, nil, nil, nil}
+	}
+	lat, lng := pointArgs(a.Location)
+	return []interface{}{a.Street, a.City, a.PostalCode, a.Notes, lat, lng}
+}
+
+// addressColumns agrupa los destinos de Scan para una dirección guardada
+// en columnas sueltas.
+type addressColumns struct {
+	street, city, postalCode, notes sql.NullString
+	lat, lng                        sql.NullFloat64
+}
+
+func (c *addressColumns) dest() []interface{} {
+	return []interface{}{&c.street, &c.city, &c.postalCode, &c.notes, &c.lat, &c.lng}
+}
+
+func (c *addressColumns) address() *models.Address {
+	if !c.street.Valid {
+		return nil
+	}
+	return &models.Address{
+		Street:     c.street.String,
+		City:       c.city.String,
+		PostalCode: c.postalCode.String,
+		Notes:      c.notes.String,
+		Location:   nullPoint(c.lat, c.lng),
+	}
+}
+
+const userColumns = `id, name, role, address,
+	address_street, address_city, address_postal_code, address_notes, address_lat, address_lng`
+
+// scanUser lee las columnas de userColumns seguidas de extra.
+func scanUser(row rowScanner, user *models.User, extra ...interface{}) error {
+	var addr addressColumns
+	dest := append([]interface{}{&user.ID, &user.Name, &user.Role, &user.Address}, addr.dest()...)
+	err := row.Scan(append(dest, extra...)...)
+	user.AddressDetails = addr.address()
+	return err
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/earnings"
+	"deliveryService/eta"
+	"deliveryService/geo"
+	"deliveryService/models"
+	"deliveryService/payments"
+	"deliveryService/routing"
+	"deliveryService/sse"
+	"github.com/gorilla/mux"
+)
+
+var errBatchTransition = errors.New("El lote no puede pasar a ese estado")
+
+type BatchHandler struct {
+	DB         *sql.DB
+	SSEManager *sse.SSEManager
+	ETA        eta.Config
+	Payments   payments.Provider
+	Earnings   earnings.Config
+}
+
+func loadBatch(db *sql.DB, id int) (models.Batch, error) {
+	var batch models.Batch
+	err := db.QueryRow(`
+		SELECT id, delivery_id, status, establishmentName, route_km, created_at, updated_at
+		FROM delivery_batches WHERE id = ?`, id,
+	).Scan(&batch.ID, &batch.DeliveryID, &batch.Status, &batch.EstablishmentName,
+		&batch.RouteKm, &batch.CreatedAt, &batch.UpdatedAt)
+	if err != nil {
+		return batch, err
+	}
+
+	rows, err := db.Query(
+		"SELECT "+orderColumns+" FROM orders WHERE batch_id = ? AND deleted_at IS NULL ORDER BY batch_seq",
+		id,
+	)
+	if err != nil {
+		return batch, err
+	}
+	defer rows.Close()
+
+	batch.Orders = []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			return batch, err
+		}
+		batch.Orders = append(batch.Orders, order)
+	}
+	return batch, rows.Err()
+}
+
+// notifyBatch recalcula la ETA de cada orden del lote y avisa a su cliente.
+func (h *BatchHandler) notifyBatch(batch *models.Batch) {
+	for i := range batch.Orders {
+		refreshOrderETA(h.DB, h.ETA, &batch.Orders[i])
+		h.SSEManager.NotifyOrderUpdate(&batch.Orders[i])
+	}
+}
+
+// CreateBatch agrupa órdenes del mismo establecimiento en un lote asignado
+// a un repartidor y calcula el orden de las entregas.
+func (h *BatchHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	var batchData struct {
+		OrderIDs   []int `json:"orderIds" validate:"required,min=2,max=20"`
+		DeliveryID int   `json:"deliveryId" validate:"required"`
+	}
+	if !decodeRequest(w, r, &batchData) {
+		return
+	}
+	// Un repartidor solo arma lotes para sí mismo
+	if !canManage(r, batchData.DeliveryID) {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+
+	// Verificar que el delivery exista
+	var role string
+	err := h.DB.QueryRow("SELECT role FROM users WHERE id = ? AND deleted_at IS NULL", batchData.DeliveryID).Scan(&role)
+	if err != nil || role != "delivery" {
+		apierror.Error(w, "Repartidor no válido", http.StatusBadRequest)
+		return
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batchData.OrderIDs)), ", ")
+	args := make([]interface{}, len(batchData.OrderIDs))
+	for i, id := range batchData.OrderIDs {
+		args[i] = id
+	}
+	rows, err := h.DB.Query(
+		"SELECT "+orderColumns+" FROM orders WHERE id IN ("+placeholders+") AND deleted_at IS NULL",
+		args...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			rows.Close()
+			apierror.Internal(w, err)
+			return
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+
+	if len(orders) != len(batchData.OrderIDs) {
+		apierror.Error(w, "Alguna de las órdenes no existe o está repetida", http.StatusNotFound)
+		return
+	}
+
+	var pickup *geo.Point
+	newOrders := 0
+	stops := make([]routing.Stop, 0, len(orders))
+	for _, order := range orders {
+		if order.EstablishmentName != orders[0].EstablishmentName {
+			apierror.Error(w, "Todas las órdenes del lote deben ser del mismo establecimiento", http.StatusBadRequest)
+			return
+		}
+		if order.BatchID != nil {
+			apierror.Error(w, "La orden "+strconv.Itoa(order.ID)+" ya pertenece a un lote", http.StatusConflict)
+			return
+		}
+		if order.Status != "pending" && order.Status != "pickup" {
+			apierror.Error(w, "La orden "+strconv.Itoa(order.ID)+" ya fue recogida", http.StatusConflict)
+			return
+		}
+		if order.DeliveryID == nil {
+			newOrders++
+		} else if *order.DeliveryID != batchData.DeliveryID {
+			apierror.Error(w, "La orden "+strconv.Itoa(order.ID)+" está asignada a otro repartidor", http.StatusConflict)
+			return
+		}
+		if pickup == nil {
+			pickup = order.EstablishmentLocation
+		}
+		stops = append(stops, routing.Stop{OrderID: order.ID, Location: order.DeliveryLocation})
+	}
+
+	route := routing.Plan(pickup, stops)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := checkCourierCapacity(tx, batchData.DeliveryID, newOrders); err != nil {
+		writeOrderUpdateError(w, err)
+		return
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO delivery_batches (delivery_id, status, establishmentName, route_km) VALUES (?, 'pickup', ?, ?)",
+		batchData.DeliveryID, orders[0].EstablishmentName, routing.Length(pickup, route),
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	batchId, _ := result.LastInsertId()
+
+	now := time.Now()
+	for seq, stop := range route {
+		// Condicional: la orden no debe haber cambiado desde que se leyó
+		result, err := tx.Exec(
+			`UPDATE orders SET delivery_id = ?, status = 'pickup', batch_id = ?, batch_seq = ?,
+				version = version + 1, updated_at = ?
+			 WHERE id = ? AND deleted_at IS NULL AND batch_id IS NULL
+				AND status IN ('pending', 'pickup') AND (delivery_id IS NULL OR delivery_id = ?)`,
+			batchData.DeliveryID, batchId, seq+1, now, stop.OrderID, batchData.DeliveryID,
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			apierror.Error(w, "La orden "+strconv.Itoa(stop.OrderID)+" fue modificada por otra petición", http.StatusConflict)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	batch, err := loadBatch(h.DB, int(batchId))
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	h.notifyBatch(&batch)
+	for _, order := range orders {
+		if order.DeliveryID == nil {
+			notifyCouriers(h.DB, h.SSEManager, "order_claimed", map[string]int{"id": order.ID}, batchData.DeliveryID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(batch)
+}
+
+func (h *BatchHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	batch, err := loadBatch(h.DB, id)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Lote no encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if !canManage(r, batch.DeliveryID) {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch)
+}
+
+// UpdateBatchStatus avanza el estado del lote un paso y lo propaga a las
+// órdenes que están en el estado anterior. Solo lo cambian el repartidor
+// del lote y los administradores.
+func (h *BatchHandler) UpdateBatchStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	var updateData struct {
+		Status string `json:"status" validate:"required,oneof=pickup in_coming arrived delivered"`
+	}
+	if !decodeRequest(w, r, &updateData) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var deliveryId int
+	var status string
+	err = tx.QueryRow(
+		"SELECT delivery_id, status FROM delivery_batches WHERE id = ? FOR UPDATE", id,
+	).Scan(&deliveryId, &status)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Lote no encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if !canManage(r, deliveryId) {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+	if !canTransition(status, updateData.Status) {
+		apierror.Error(w, errBatchTransition.Error(), http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE delivery_batches SET status = ? WHERE id = ?", updateData.Status, id)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	// Las órdenes que ya avanzaron o se cancelaron por su cuenta se dejan
+	// como están; el resto se actualiza con la versión leída, igual que
+	// updateOrder, para no pisar un cambio concurrente
+	rows, err := tx.Query(
+		"SELECT id, version, status FROM orders WHERE batch_id = ? AND deleted_at IS NULL", id,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	type member struct {
+		id, version int
+		status      string
+	}
+	var members []member
+	for rows.Next() {
+		var m member
+		if err := rows.Scan(&m.id, &m.version, &m.status); err != nil {
+			rows.Close()
+			apierror.Internal(w, err)
+			return
+		}
+		members = append(members, m)
+	}
+	rows.Close()
+
+	now := time.Now()
+	moved := map[int]bool{}
+	for _, m := range members {
+		if !canTransition(m.status, updateData.Status) {
+			continue
+		}
+		result, err := tx.Exec(
+			`UPDATE orders SET status = ?, version = version + 1, updated_at = ?,
+				delivered_at = IF(? = 'delivered', ?, delivered_at)
+			 WHERE id = ? AND version = ? AND status = ? AND deleted_at IS NULL`,
+			updateData.Status, now, updateData.Status, now, m.id, m.version, m.status,
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			apierror.Error(w, "La orden "+strconv.Itoa(m.id)+" fue modificada por otra petición", http.StatusConflict)
+			return
+		}
+		moved[m.id] = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	batch, err := loadBatch(h.DB, id)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	for i := range batch.Orders {
+		if moved[batch.Orders[i].ID] {
+			settlePayment(h.DB, h.Payments, &batch.Orders[i])
+			recordCourierEarning(h.DB, h.Earnings, &batch.Orders[i])
+		}
+	}
+	h.notifyBatch(&batch)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch)
+}
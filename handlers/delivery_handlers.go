@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/eta"
+	"deliveryService/geo"
+	"deliveryService/models"
+	"deliveryService/sse"
+)
+
+type DeliveryHandler struct {
+	DB         *sql.DB
+	SSEManager *sse.SSEManager
+	ETA        eta.Config
+}
+
+// GetAvailableOrders lista las órdenes pendientes sin repartidor, las más
+// antiguas primero.
+func (h *DeliveryHandler) GetAvailableOrders(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT ` + orderColumns + `
+		FROM orders WHERE status = 'pending' AND delivery_id IS NULL AND deleted_at IS NULL
+		ORDER BY created_at ASC, id ASC`)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		err := scanOrder(rows, &order)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		orders = append(orders, order)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+var (
+	errCourierUnavailable = errors.New("El repartidor no está disponible")
+	errCourierOverloaded  = errors.New("El repartidor alcanzó su máximo de órdenes activas")
+)
+
+func loadCourierStatus(db queryRower, courierId int) (models.CourierStatus, error) {
+	status := models.CourierStatus{UserID: courierId}
+	var updatedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT u.availability, u.availability_updated_at, u.max_active_orders,
+			(SELECT COUNT(*) FROM orders o
+			 WHERE o.delivery_id = u.id AND o.status NOT IN ('delivered', 'cancelled') AND o.deleted_at IS NULL)
+		FROM users u WHERE u.id = ? AND u.role = 'delivery' AND u.deleted_at IS NULL`,
+		courierId,
+	).Scan(&status.Availability, &updatedAt, &status.MaxActiveOrders, &status.ActiveOrders)
+	status.UpdatedAt = updatedAt.Time
+	return status, err
+}
+
+// checkCourierCapacity verifica que el repartidor esté en línea y tenga
+// capacidad para extra órdenes más. Se llama dentro de la transacción que
+// asigna las órdenes: bloquea la fila del repartidor para que las
+// asignaciones concurrentes se serialicen y no superen max_active_orders.
+func checkCourierCapacity(tx *sql.Tx, courierId, extra int) error {
+	var availability string
+	var maxActive, active int
+	err := tx.QueryRow(
+		"SELECT availability, max_active_orders FROM users WHERE id = ? AND role = 'delivery' AND deleted_at IS NULL FOR UPDATE",
+		courierId,
+	).Scan(&availability, &maxActive)
+	if err == sql.ErrNoRows {
+		return errCourierUnavailable
+	} else if err != nil {
+		return err
+	}
+	if availability != "online" {
+		return errCourierUnavailable
+	}
+
+	// Lectura con bloqueo para contar también lo confirmado por la
+	// transacción que tenía el repartidor bloqueado antes que esta
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FROM orders
+		 WHERE delivery_id = ? AND status NOT IN ('delivered', 'cancelled') AND deleted_at IS NULL
+		 LOCK IN SHARE MODE`,
+		courierId,
+	).Scan(&active)
+	if err != nil {
+		return err
+	}
+	if active+extra > maxActive {
+		return errCourierOverloaded
+	}
+	return nil
+}
+
+func (h *DeliveryHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	courierId, _ := r.Context().Value("user_id").(int)
+
+	status, err := loadCourierStatus(h.DB, courierId)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// UpdateStatus cambia la disponibilidad del repartidor autenticado
+// (online, paused u offline).
+func (h *DeliveryHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
+	courierId, _ := r.Context().Value("user_id").(int)
+
+	var statusData struct {
+		Availability string `json:"availability" validate:"required,oneof=online paused offline"`
+	}
+	if !decodeRequest(w, r, &statusData) {
+		return
+	}
+
+	_, err := h.DB.Exec(
+		"UPDATE users SET availability = ?, availability_updated_at = ? WHERE id = ?",
+		statusData.Availability, time.Now(), courierId,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	status, err := loadCourierStatus(h.DB, courierId)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// UpdateLocation registra la posición GPS del repartidor autenticado y la
+// transmite a los clientes de sus órdenes en curso (de pickup a arrived).
+func (h *DeliveryHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	courierId, _ := r.Context().Value("user_id").(int)
+
+	// Punteros para distinguir una coordenada ausente de 0
+	var body struct {
+		Lat *float64 `json:"lat" validate:"required,min=-90,max=90"`
+		Lng *float64 `json:"lng" validate:"required,min=-180,max=180"`
+	}
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+	ping := geo.Point{Lat: *body.Lat, Lng: *body.Lng}
+
+	now := time.Now()
+	_, err := h.DB.Exec(
+		`INSERT INTO courier_locations (courier_id, lat, lng, updated_at) VALUES (?, ?, ?, ?)
+		 ON DUPLICATE KEY UPDATE lat = VALUES(lat), lng = VALUES(lng), updated_at = VALUES(updated_at)`,
+		courierId, ping.Lat, ping.Lng, now,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT `+orderColumns+` FROM orders
+		WHERE delivery_id = ? AND status IN ('pickup', 'in_coming', 'arrived') AND deleted_at IS NULL`,
+		courierId,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	var activeOrders []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			rows.Close()
+			apierror.Internal(w, err)
+			return
+		}
+		activeOrders = append(activeOrders, order)
+	}
+	rows.Close()
+
+	for _, order := range activeOrders {
+		_, err = h.DB.Exec(
+			"INSERT INTO order_location_trail (order_id, courier_id, lat, lng, recorded_at) VALUES (?, ?, ?, ?, ?)",
+			order.ID, courierId, ping.Lat, ping.Lng, now,
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+
+		refreshOrderETA(h.DB, h.ETA, &order)
+		h.SSEManager.NotifyUser(order.UserID, "courier_location", models.LocationPoint{
+			OrderID:             order.ID,
+			Lat:                 ping.Lat,
+			Lng:                 ping.Lng,
+			RecordedAt:          now,
+			EstimatedDeliveryAt: order.EstimatedDeliveryAt,
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notifyCouriers envía un evento a todos los repartidores conectados salvo
+// exceptId, para mantener sincronizada la bolsa de trabajo.
+func notifyCouriers(db *sql.DB, sseManager *sse.SSEManager, event string, data interface{}, exceptId int) {
+	rows, err := db.Query(
+		"SELECT id FROM users WHERE role = 'delivery' AND deleted_at IS NULL AND id <> ?",
+		exceptId,
+	)
+	if err != nil {
+		log.Printf("Error obteniendo repartidores: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var courierId int
+		if err := rows.Scan(&courierId); err != nil {
+			log.Printf("Error leyendo repartidor: %v", err)
+			return
+		}
+		// Los repartidores desconectados simplemente no reciben el evento
+		sseManager.NotifyUser(courierId, event, data)
+	}
+}
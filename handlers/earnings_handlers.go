@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/earnings"
+	"deliveryService/geo"
+	"deliveryService/ledger"
+	"deliveryService/models"
+	"deliveryService/money"
+)
+
+const earningColumns = `id, order_id, courier_id, base_fee, distance_fee, distance_km, tip, total,
+	payout_id, created_at`
+
+func scanEarning(row rowScanner, e *models.CourierEarning) error {
+	return row.Scan(&e.ID, &e.OrderID, &e.CourierID, &e.BaseFee, &e.DistanceFee, &e.DistanceKm,
+		&e.Tip, &e.Total, &e.PayoutID, &e.CreatedAt)
+}
+
+// recordCourierEarning registra la ganancia del repartidor al entregarse la
+// orden, con su asiento contable: gasto de entrega y propina contra la
+// cuenta por pagar del repartidor. Es idempotente por orden.
+func recordCourierEarning(db *sql.DB, cfg earnings.Config, order *models.Order) {
+	if order.Status != "delivered" || order.DeliveryID == nil {
+		return
+	}
+
+	var distanceKm *float64
+	if order.EstablishmentLocation != nil && order.DeliveryLocation != nil {
+		km := geo.DistanceKm(*order.EstablishmentLocation, *order.DeliveryLocation)
+		distanceKm = &km
+	}
+	b := cfg.Compute(distanceKm, order.Tip)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error registrando ganancia de la orden %d: %v", order.ID, err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT IGNORE INTO courier_earnings (order_id, courier_id, base_fee, distance_fee, distance_km, tip, total)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		order.ID, *order.DeliveryID, b.BaseFee, b.DistanceFee, b.DistanceKm, b.Tip, b.Total,
+	)
+	if err != nil {
+		log.Printf("Error registrando ganancia de la orden %d: %v", order.ID, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return
+	}
+
+	entries := []ledger.Entry{
+		{Account: ledger.DeliveryExpense, Debit: b.BaseFee + b.DistanceFee},
+		{Account: ledger.CourierAccount(*order.DeliveryID), Credit: b.Total},
+	}
+	if b.Tip > 0 {
+		entries = append(entries, ledger.Entry{Account: ledger.Tips, Debit: b.Tip})
+	}
+	err = ledger.Post(tx, "courier_earning", "order:"+strconv.Itoa(order.ID), entries...)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error registrando ganancia de la orden %d: %v", order.ID, err)
+	}
+}
+
+// weekStart devuelve el lunes a las 00:00 (hora local) de la semana de t.
+func weekStart(t time.Time) time.Time {
+	days := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -days).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// GetEarnings resume las ganancias del repartidor autenticado entre from y
+// to (por defecto, la semana en curso).
+func (h *DeliveryHandler) GetEarnings(w http.ResponseWriter, r *http.Request) {
+	courierId, _ := r.Context().Value("user_id").(int)
+	query := r.URL.Query()
+
+	summary := models.EarningsSummary{From: weekStart(time.Now()), To: time.Now()}
+	if v := query.Get("from"); v != "" {
+		from, err := parseDateParam(v)
+		if err != nil {
+			apierror.Error(w, "from debe ser una fecha RFC3339 o YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		summary.From = from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := parseDateParam(v)
+		if err != nil {
+			apierror.Error(w, "to debe ser una fecha RFC3339 o YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		// Una fecha sin hora incluye el día completo
+		if len(v) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+		summary.To = to
+	}
+
+	rows, err := h.DB.Query(
+		"SELECT "+earningColumns+` FROM courier_earnings
+		 WHERE courier_id = ? AND created_at >= ? AND created_at < ? ORDER BY created_at, id`,
+		courierId, summary.From, summary.To,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	// Una propina posterior a la entrega es otra fila de la misma orden
+	orders := map[int]bool{}
+	summary.Earnings = []models.CourierEarning{}
+	for rows.Next() {
+		var e models.CourierEarning
+		if err := scanEarning(rows, &e); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		orders[e.OrderID] = true
+		summary.BaseFees += e.BaseFee
+		summary.DistanceFees += e.DistanceFee
+		summary.Tips += e.Tip
+		summary.Total += e.Total
+		summary.Earnings = append(summary.Earnings, e)
+	}
+
+	summary.Orders = len(orders)
+
+	summary.Balance, err = ledger.Balance(h.DB, ledger.CourierAccount(courierId))
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// GenerateWeeklyPayouts liquida las ganancias pendientes de la semana que
+// empieza en weekStart (un lunes; por defecto la última semana completa) y
+// devuelve el estado de pagos de esa semana en CSV. Repetirla solo liquida
+// las ganancias que se hayan registrado después.
+func (h *DeliveryHandler) GenerateWeeklyPayouts(w http.ResponseWriter, r *http.Request) {
+	start := weekStart(time.Now()).AddDate(0, 0, -7)
+	if v := r.URL.Query().Get("weekStart"); v != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil || parsed.Weekday() != time.Monday {
+			apierror.Error(w, "weekStart debe ser un lunes en formato YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		start = parsed
+	}
+	end := start.AddDate(0, 0, 7)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT courier_id, total FROM courier_earnings
+		 WHERE payout_id IS NULL AND created_at >= ? AND created_at < ? FOR UPDATE`,
+		start, end,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	pending := map[int]money.Amount{}
+	var couriers []int
+	for rows.Next() {
+		var courierId int
+		var total money.Amount
+		if err := rows.Scan(&courierId, &total); err != nil {
+			rows.Close()
+			apierror.Internal(w, err)
+			return
+		}
+		if _, ok := pending[courierId]; !ok {
+			couriers = append(couriers, courierId)
+		}
+		pending[courierId] += total
+	}
+	rows.Close()
+
+	for _, courierId := range couriers {
+		total := pending[courierId]
+		result, err := tx.Exec(
+			`INSERT INTO payouts (courier_id, week_start, total) VALUES (?, ?, ?)
+			 ON DUPLICATE KEY UPDATE total = total + VALUES(total), id = LAST_INSERT_ID(id)`,
+			courierId, start.Format("2006-01-02"), total,
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		payoutId, _ := result.LastInsertId()
+
+		_, err = tx.Exec(
+			`UPDATE courier_earnings SET payout_id = ?
+			 WHERE courier_id = ? AND payout_id IS NULL AND created_at >= ? AND created_at < ?`,
+			payoutId, courierId, start, end,
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+
+		err = ledger.Post(tx, "courier_payout", "payout:"+strconv.FormatInt(payoutId, 10),
+			ledger.Entry{Account: ledger.CourierAccount(courierId), Debit: total},
+			ledger.Entry{Account: ledger.Cash, Credit: total},
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	statement, err := h.DB.Query(`
+		SELECT p.id, p.courier_id, u.name, COUNT(DISTINCT e.order_id),
+			COALESCE(SUM(e.base_fee), 0), COALESCE(SUM(e.distance_fee), 0), COALESCE(SUM(e.tip), 0), p.total
+		FROM payouts p
+		JOIN users u ON u.id = p.courier_id
+		LEFT JOIN courier_earnings e ON e.payout_id = p.id
+		WHERE p.week_start = ?
+		GROUP BY p.id, p.courier_id, u.name, p.total
+		ORDER BY u.name`,
+		start.Format("2006-01-02"),
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer statement.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="payouts-`+start.Format("2006-01-02")+`.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"payout_id", "courier_id", "courier", "week_start", "orders", "base_fees", "distance_fees", "tips", "total"})
+	for statement.Next() {
+		var payoutId, courierId, orders int
+		var name string
+		var base, distance, tips, total money.Amount
+		if err := statement.Scan(&payoutId, &courierId, &name, &orders, &base, &distance, &tips, &total); err != nil {
+			log.Printf("Error generando estado de pagos: %v", err)
+			break
+		}
+		out.Write([]string{
+			strconv.Itoa(payoutId), strconv.Itoa(courierId), csvText(name), start.Format("2006-01-02"),
+			strconv.Itoa(orders), base.String(), distance.String(), tips.String(), total.String(),
+		})
+	}
+	out.Flush()
+}
+
+// csvText neutraliza los textos que una hoja de cálculo interpretaría como
+// fórmula anteponiéndoles un apóstrofo.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
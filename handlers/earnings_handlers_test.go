@@ -0,0 +1,23 @@
+package handlers
+
+import "testing"
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Ana López", "Ana López"},
+		{"", ""},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+52 55", "'+52 55"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tdato", "'\tdato"},
+		{"Ana=1", "Ana=1"},
+	}
+	for _, tt := range tests {
+		if got := csvText(tt.in); got != tt.want {
+			t.Errorf("csvText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/geocoding"
+	"deliveryService/models"
+	"github.com/gorilla/mux"
+)
+
+type EstablishmentHandler struct {
+	DB       *sql.DB
+	Geocoder geocoding.Geocoder
+}
+
+const establishmentColumns = `id, owner_id, name, description,
+	address_street, address_city, address_postal_code, address_notes, address_lat, address_lng,
+	opening_hours, active, created_at, updated_at`
+
+func scanEstablishment(row rowScanner, e *models.Establishment) error {
+	var addr addressColumns
+	var hours sql.NullString
+	dest := append([]interface{}{&e.ID, &e.OwnerID, &e.Name, &e.Description}, addr.dest()...)
+	dest = append(dest, &hours, &e.Active, &e.CreatedAt, &e.UpdatedAt)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	e.Address = addr.address()
+	e.OpeningHours = []models.OpeningHours{}
+	if hours.Valid {
+		return json.Unmarshal([]byte(hours.String), &e.OpeningHours)
+	}
+	return nil
+}
+
+func loadEstablishment(db *sql.DB, id int) (models.Establishment, error) {
+	var e models.Establishment
+	err := scanEstablishment(db.QueryRow(
+		"SELECT "+establishmentColumns+" FROM establishments WHERE id = ?", id,
+	), &e)
+	return e, err
+}
+
+func loadMenu(db *sql.DB, establishmentId int) ([]models.MenuItem, error) {
+	rows, err := db.Query(
+		"SELECT id, establishment_id, name, description, price, available FROM menu_items WHERE establishment_id = ? ORDER BY id",
+		establishmentId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	menu := []models.MenuItem{}
+	index := map[int]int{}
+	for rows.Next() {
+		item := models.MenuItem{Modifiers: []models.MenuModifier{}}
+		err := rows.Scan(&item.ID, &item.EstablishmentID, &item.Name, &item.Description, &item.Price, &item.Available)
+		if err != nil {
+			return nil, err
+		}
+		index[item.ID] = len(menu)
+		menu = append(menu, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	modRows, err := db.Query(`
+		SELECT m.id, m.menu_item_id, m.name, m.price
+		FROM menu_item_modifiers m JOIN menu_items i ON i.id = m.menu_item_id
+		WHERE i.establishment_id = ? ORDER BY m.id`,
+		establishmentId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer modRows.Close()
+
+	for modRows.Next() {
+		var mod models.MenuModifier
+		var itemId int
+		if err := modRows.Scan(&mod.ID, &itemId, &mod.Name, &mod.Price); err != nil {
+			return nil, err
+		}
+		if i, ok := index[itemId]; ok {
+			menu[i].Modifiers = append(menu[i].Modifiers, mod)
+		}
+	}
+	return menu, modRows.Err()
+}
+
+// replaceModifiers sustituye los modificadores del producto por los recibidos.
+func replaceModifiers(tx *sql.Tx, item *models.MenuItem) error {
+	_, err := tx.Exec("DELETE FROM menu_item_modifiers WHERE menu_item_id = ?", item.ID)
+	if err != nil {
+		return err
+	}
+	if item.Modifiers == nil {
+		item.Modifiers = []models.MenuModifier{}
+	}
+	for i := range item.Modifiers {
+		mod := &item.Modifiers[i]
+		result, err := tx.Exec(
+			"INSERT INTO menu_item_modifiers (menu_item_id, name, price) VALUES (?, ?, ?)",
+			item.ID, mod.Name, mod.Price,
+		)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		mod.ID = int(id)
+	}
+	return nil
+}
+
+// canManage indica si el usuario autenticado es el propietario o un admin.
+func canManage(r *http.Request, ownerId int) bool {
+	userId, _ := r.Context().Value("user_id").(int)
+	role, _ := r.Context().Value("user_role").(string)
+	return role == "admin" || userId == ownerId
+}
+
+func establishmentArgs(e *models.Establishment) []interface{} {
+	var hours interface{}
+	if len(e.OpeningHours) > 0 {
+		raw, _ := json.Marshal(e.OpeningHours)
+		hours = string(raw)
+	}
+	args := append([]interface{}{e.OwnerID, e.Name, e.Description}, addressArgs(e.Address)...)
+	return append(args, hours, e.Active)
+}
+
+func (h *EstablishmentHandler) GetEstablishments(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query("SELECT " + establishmentColumns + " FROM establishments WHERE active = TRUE ORDER BY name")
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	establishments := []models.Establishment{}
+	for rows.Next() {
+		var e models.Establishment
+		if err := scanEstablishment(rows, &e); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		establishments = append(establishments, e)
+	}
+	rows.Close()
+
+	ratings, err := loadRatings(h.DB, "establishment")
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	for i := range establishments {
+		establishments[i].Rating = ratings[establishments[i].ID]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(establishments)
+}
+
+func (h *EstablishmentHandler) GetEstablishment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	e, err := loadEstablishment(h.DB, id)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Establecimiento no encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	e.Menu, err = loadMenu(h.DB, id)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	e.Rating, err = loadRating(h.DB, "establishment", id)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+// CreateEstablishment da de alta un establecimiento. El propietario es el
+// usuario autenticado; un admin puede indicar ownerId.
+func (h *EstablishmentHandler) CreateEstablishment(w http.ResponseWriter, r *http.Request) {
+	e := models.Establishment{Active: true}
+	if !decodeRequest(w, r, &e) {
+		return
+	}
+
+	if role, _ := r.Context().Value("user_role").(string); role != "admin" || e.OwnerID == 0 {
+		e.OwnerID, _ = r.Context().Value("user_id").(int)
+	}
+	if err := resolveAddress(h.Geocoder, e.Address); err != nil {
+		apierror.Error(w, err.Error(), addressStatus(err))
+		return
+	}
+
+	result, err := h.DB.Exec(
+		`INSERT INTO establishments (owner_id, name, description, address_street, address_city,
+			address_postal_code, address_notes, address_lat, address_lng, opening_hours, active)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		establishmentArgs(&e)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	e, err = loadEstablishment(h.DB, int(id))
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *EstablishmentHandler) UpdateEstablishment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	current, err := loadEstablishment(h.DB, id)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Establecimiento no encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if !canManage(r, current.OwnerID) {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+
+	e := models.Establishment{Active: true}
+	if !decodeRequest(w, r, &e) {
+		return
+	}
+	e.OwnerID = current.OwnerID
+	if err := resolveAddress(h.Geocoder, e.Address); err != nil {
+		apierror.Error(w, err.Error(), addressStatus(err))
+		return
+	}
+
+	_, err = h.DB.Exec(
+		`UPDATE establishments SET owner_id = ?, name = ?, description = ?, address_street = ?,
+			address_city = ?, address_postal_code = ?, address_notes = ?, address_lat = ?,
+			address_lng = ?, opening_hours = ?, active = ?
+		 WHERE id = ?`,
+		append(establishmentArgs(&e), id)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	e, err = loadEstablishment(h.DB, id)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func (h *EstablishmentHandler) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	establishmentId, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	e, err := loadEstablishment(h.DB, establishmentId)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Establecimiento no encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if !canManage(r, e.OwnerID) {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+
+	item := models.MenuItem{Available: true}
+	if !decodeRequest(w, r, &item) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO menu_items (establishment_id, name, description, price, available) VALUES (?, ?, ?, ?, ?)",
+		establishmentId, item.Name, item.Description, item.Price, item.Available,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	item.ID = int(id)
+	item.EstablishmentID = establishmentId
+	if err := replaceModifiers(tx, &item); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+func (h *EstablishmentHandler) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	establishmentId, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+	itemId, err := strconv.Atoi(vars["itemId"])
+	if err != nil {
+		apierror.Error(w, "ID de producto inválido", http.StatusBadRequest)
+		return
+	}
+
+	e, err := loadEstablishment(h.DB, establishmentId)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Establecimiento no encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if !canManage(r, e.OwnerID) {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+
+	item := models.MenuItem{Available: true}
+	if !decodeRequest(w, r, &item) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE menu_items SET name = ?, description = ?, price = ?, available = ? WHERE id = ? AND establishment_id = ?",
+		item.Name, item.Description, item.Price, item.Available, itemId, establishmentId,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Producto no encontrado", http.StatusNotFound)
+		return
+	}
+
+	item.ID = itemId
+	item.EstablishmentID = establishmentId
+	if err := replaceModifiers(tx, &item); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+func (h *EstablishmentHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	establishmentId, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+	itemId, err := strconv.Atoi(vars["itemId"])
+	if err != nil {
+		apierror.Error(w, "ID de producto inválido", http.StatusBadRequest)
+		return
+	}
+
+	e, err := loadEstablishment(h.DB, establishmentId)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Establecimiento no encontrado", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if !canManage(r, e.OwnerID) {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+
+	result, err := h.DB.Exec("DELETE FROM menu_items WHERE id = ? AND establishment_id = ?", itemId, establishmentId)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Producto no encontrado", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var (
+	errEstablishmentUnavailable = errors.New("El establecimiento no existe o no está activo")
+	errEstablishmentClosed      = errors.New("El establecimiento está cerrado")
+	errEstablishmentClosedAt    = errors.New("El establecimiento está cerrado a la hora programada")
+	errOrderItemsRequired       = errors.New("La orden debe incluir al menos un producto con cantidad positiva")
+	errMenuItemUnavailable      = errors.New("Producto no disponible en el menú del establecimiento")
+	errModifierUnavailable      = errors.New("Modificador no válido para el producto")
+)
+
+// applyEstablishment completa la orden con los datos del establecimiento y
+// valida sus líneas contra el menú. Nombre, dirección y precios se copian a
+// la orden para conservar cómo estaban al momento de la compra.
+func applyEstablishment(db *sql.DB, order *models.Order) error {
+	if order.EstablishmentID == nil {
+		return errEstablishmentUnavailable
+	}
+	if len(order.Items) == 0 {
+		return errOrderItemsRequired
+	}
+
+	e, err := loadEstablishment(db, *order.EstablishmentID)
+	if err == sql.ErrNoRows || (err == nil && !e.Active) {
+		return errEstablishmentUnavailable
+	} else if err != nil {
+		return err
+	}
+	if order.ScheduledFor != nil {
+		if !e.IsOpenAt(*order.ScheduledFor) {
+			return errEstablishmentClosedAt
+		}
+	} else if !e.IsOpenAt(time.Now()) {
+		return errEstablishmentClosed
+	}
+
+	menu, err := loadMenu(db, e.ID)
+	if err != nil {
+		return err
+	}
+	byId := make(map[int]models.MenuItem, len(menu))
+	for _, item := range menu {
+		byId[item.ID] = item
+	}
+
+	var summary []string
+	for i := range order.Items {
+		line := &order.Items[i]
+		if line.Quantity < 1 {
+			return errOrderItemsRequired
+		}
+		item, ok := byId[line.MenuItemID]
+		if !ok || !item.Available {
+			return errMenuItemUnavailable
+		}
+		line.Name = item.Name
+		line.UnitPrice = item.Price
+		line.Modifiers = []models.OrderItemModifier{}
+		for _, modId := range line.ModifierIDs {
+			mod, ok := findModifier(item.Modifiers, modId)
+			if !ok {
+				return errModifierUnavailable
+			}
+			line.Modifiers = append(line.Modifiers, models.OrderItemModifier{ID: mod.ID, Name: mod.Name, Price: mod.Price})
+		}
+		line.ModifierIDs = nil
+		line.ComputeTotal()
+		summary = append(summary, strconv.Itoa(line.Quantity)+"x "+item.Name)
+	}
+
+	order.EstablishmentName = e.Name
+	order.EstablishmentAddressDetails = e.Address
+	order.EstablishmentAddr = e.Address.String()
+	order.EstablishmentLocation = e.Address.Location
+	if order.Title == "" {
+		order.Title = "Pedido en " + e.Name
+	}
+	if order.Description == "" {
+		order.Description = strings.Join(summary, ", ")
+	}
+	return nil
+}
+
+func writeEstablishmentError(w http.ResponseWriter, err error) {
+	switch err {
+	case errEstablishmentUnavailable, errOrderItemsRequired:
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+	case errEstablishmentClosed, errEstablishmentClosedAt, errMenuItemUnavailable, errModifierUnavailable:
+		apierror.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		apierror.Internal(w, err)
+	}
+}
+
+func findModifier(mods []models.MenuModifier, id int) (models.MenuModifier, bool) {
+	for _, mod := range mods {
+		if mod.ID == id {
+			return mod, true
+		}
+	}
+	return models.MenuModifier{}, false
+}
+
+func insertOrderItems(tx *sql.Tx, orderId int, items []models.OrderItem) error {
+	for _, item := range items {
+		modifiers, err := json.Marshal(item.Modifiers)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"INSERT INTO order_items (order_id, menu_item_id, name, quantity, unit_price, modifiers) VALUES (?, ?, ?, ?, ?, ?)",
+			orderId, item.MenuItemID, item.Name, item.Quantity, item.UnitPrice, string(modifiers),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadOrderItems(db *sql.DB, orderId int) ([]models.OrderItem, error) {
+	rows, err := db.Query(
+		"SELECT COALESCE(menu_item_id, 0), name, quantity, unit_price, modifiers FROM order_items WHERE order_id = ? ORDER BY id",
+		orderId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.OrderItem{}
+	for rows.Next() {
+		var item models.OrderItem
+		var modifiers sql.NullString
+		if err := rows.Scan(&item.MenuItemID, &item.Name, &item.Quantity, &item.UnitPrice, &modifiers); err != nil {
+			return nil, err
+		}
+		item.Modifiers = []models.OrderItemModifier{}
+		if modifiers.Valid {
+			if err := json.Unmarshal([]byte(modifiers.String), &item.Modifiers); err != nil {
+				return nil, err
+			}
+		}
+		item.ComputeTotal()
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"deliveryService/eta"
+	"deliveryService/geo"
+	"deliveryService/models"
+)
+
+// refreshOrderETA recalcula las horas estimadas de la orden con la última
+// posición conocida del repartidor y las guarda sin tocar updated_at ni la
+// versión, ya que son datos derivados y no una modificación del cliente.
+func refreshOrderETA(db *sql.DB, cfg eta.Config, order *models.Order) {
+	var courier *geo.Point
+	if order.DeliveryID != nil {
+		var lat, lng sql.NullFloat64
+		err := db.QueryRow(
+			"SELECT lat, lng FROM courier_locations WHERE courier_id = ?",
+			*order.DeliveryID,
+		).Scan(&lat, &lng)
+		if err == nil {
+			courier = nullPoint(lat, lng)
+		}
+	}
+
+	est := cfg.Estimate(eta.Input{
+		Status:        order.Status,
+		CreatedAt:     order.CreatedAt,
+		Courier:       courier,
+		Establishment: order.EstablishmentLocation,
+		Destination:   order.DeliveryLocation,
+	}, time.Now())
+
+	_, err := db.Exec(
+		`UPDATE orders SET estimated_pickup_at = ?, estimated_delivery_at = ?, updated_at = updated_at
+		 WHERE id = ?`,
+		est.PickupAt, est.DeliveryAt, order.ID,
+	)
+	if err != nil {
+		log.Printf("Error actualizando ETA de la orden %d: %v", order.ID, err)
+		return
+	}
+	order.EstimatedPickupAt = est.PickupAt
+	order.EstimatedDeliveryAt = est.DeliveryAt
+}
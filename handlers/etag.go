@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Las órdenes usan su versión como ETag fuerte: "3".
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// parseIfMatch devuelve la versión esperada por el cliente, o 0 si no envió
+// If-Match (o envió "*") y la actualización no debe ser condicional.
+func parseIfMatch(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, errors.New("If-Match inválido")
+	}
+	return version, nil
+}
@@ -3,110 +3,459 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"deliveryService/apierror"
+	"deliveryService/dispatch"
+	"deliveryService/earnings"
+	"deliveryService/eta"
+	"deliveryService/geo"
 	"deliveryService/models"
+	"deliveryService/money"
+	"deliveryService/payments"
+	"deliveryService/pricing"
 	"deliveryService/sse"
+	"deliveryService/zones"
 	"github.com/gorilla/mux"
 )
 
 type OrderHandler struct {
 	DB        *sql.DB
 	SSEManager *sse.SSEManager
+	Dispatcher *dispatch.Engine
+	ETA        eta.Config
+	Pricing    pricing.Config
+	Payments   payments.Provider
+	Earnings   earnings.Config
+	TipWindow  time.Duration
+
+	// ScheduleLead es la antelación con la que una orden programada pasa a
+	// "pending"; ScheduleHorizon limita cuánto se puede programar a futuro.
+	ScheduleLead    time.Duration
+	ScheduleHorizon time.Duration
+}
+
+const orderColumns = `id, title, description, status, establishmentName,
+	establishmentAddress, price, user_id, delivery_id, created_at, updated_at, version,
+	establishment_lat, establishment_lng, delivery_lat, delivery_lng,
+	estimated_pickup_at, estimated_delivery_at,
+	establishment_street, establishment_city, establishment_postal_code, establishment_notes,
+	zone_id, batch_id, batch_seq, establishment_id,
+	subtotal, delivery_fee, service_fee, tax, surge_multiplier, promo_code, discount,
+	(SELECT p.status FROM payments p WHERE p.order_id = orders.id ORDER BY p.id DESC LIMIT 1),
+	tip, delivered_at, scheduled_for`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrder(row rowScanner, order *models.Order) error {
+	var est addressColumns
+	var delLat, delLng, surge sql.NullFloat64
+	var subtotal, deliveryFee, serviceFee, tax *money.Amount
+	var discount money.Amount
+	var promoCode, paymentStatus sql.NullString
+	err := row.Scan(&order.ID, &order.Title, &order.Description, &order.Status,
+		&order.EstablishmentName, &order.EstablishmentAddr, &order.Price,
+		&order.UserID, &order.DeliveryID, &order.CreatedAt, &order.UpdatedAt,
+		&order.Version, &est.lat, &est.lng, &delLat, &delLng,
+		&order.EstimatedPickupAt, &order.EstimatedDeliveryAt,
+		&est.street, &est.city, &est.postalCode, &est.notes,
+		&order.ZoneID, &order.BatchID, &order.BatchSequence, &order.EstablishmentID,
+		&subtotal, &deliveryFee, &serviceFee, &tax, &surge, &promoCode, &discount, &paymentStatus,
+		&order.Tip, &order.DeliveredAt, &order.ScheduledFor)
+	order.PromoCode = promoCode.String
+	order.PaymentStatus = paymentStatus.String
+	// Las órdenes anteriores al desglose solo tienen price
+	if subtotal != nil {
+		order.PriceBreakdown = &pricing.Breakdown{
+			Subtotal: *subtotal, Discount: discount, DeliveryFee: *deliveryFee, ServiceFee: *serviceFee,
+			Tax: *tax, SurgeMultiplier: surge.Float64, Tip: order.Tip, Total: order.Price,
+		}
+	}
+	order.EstablishmentLocation = nullPoint(est.lat, est.lng)
+	order.EstablishmentAddressDetails = est.address()
+	order.DeliveryLocation = nullPoint(delLat, delLng)
+	return err
+}
+
+func nullPoint(lat, lng sql.NullFloat64) *geo.Point {
+	if !lat.Valid || !lng.Valid {
+		return nil
+	}
+	return &geo.Point{Lat: lat.Float64, Lng: lng.Float64}
+}
+
+func pointArgs(p *geo.Point) (interface{}, interface{}) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.Lat, p.Lng
+}
+
+var (
+	errCoverageLocationsRequired = errors.New("Se requieren las ubicaciones del establecimiento y de entrega para verificar la cobertura")
+	errOutOfCoverage             = errors.New("La dirección de entrega o del establecimiento está fuera de la zona de cobertura")
+	errInvalidTip                = errors.New("La propina no puede ser negativa")
+)
+
+// prepareOrder completa una orden recibida del cliente: catálogo, destino,
+// cobertura y precio. Lo comparten la creación y la cotización.
+func (h *OrderHandler) prepareOrder(order *models.Order) error {
+	if order.UserID == 0 {
+		order.UserID = 1
+	}
+	if order.Tip < 0 {
+		return errInvalidTip
+	}
+	if err := h.validateSchedule(order, time.Now()); err != nil {
+		return err
+	}
+
+	// El establecimiento y sus productos salen del catálogo, no del cliente
+	if err := applyEstablishment(h.DB, order); err != nil {
+		return err
+	}
+
+	// Si no se indica destino, se entrega en la dirección del cliente
+	if order.DeliveryLocation == nil {
+		var lat, lng sql.NullFloat64
+		err := h.DB.QueryRow(
+			"SELECT address_lat, address_lng FROM users WHERE id = ? AND deleted_at IS NULL",
+			order.UserID,
+		).Scan(&lat, &lng)
+		if err == nil {
+			order.DeliveryLocation = nullPoint(lat, lng)
+		}
+	}
+
+	// Cobertura: establecimiento y destino deben estar en una misma zona.
+	// Sin zonas configuradas no se restringe.
+	activeZones, err := zones.LoadActive(h.DB)
+	if err != nil {
+		return err
+	}
+	var zone *models.Zone
+	order.ZoneID = nil
+	if len(activeZones) > 0 {
+		if order.EstablishmentLocation == nil || order.DeliveryLocation == nil {
+			return errCoverageLocationsRequired
+		}
+		zone = zones.Find(activeZones, *order.EstablishmentLocation, *order.DeliveryLocation)
+		if zone == nil {
+			return errOutOfCoverage
+		}
+		order.ZoneID = &zone.ID
+	}
+
+	return quoteOrder(h.DB, h.Pricing, order, zone)
+}
+
+func writePrepareOrderError(w http.ResponseWriter, err error) {
+	switch err {
+	case errCoverageLocationsRequired, errOutOfCoverage:
+		apierror.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errInvalidTip, errScheduleTooSoon, errScheduleTooFar:
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		if !writePromotionError(w, err) {
+			writeEstablishmentError(w, err)
+		}
+	}
+}
+
+// QuoteOrder devuelve el desglose de precio de una orden sin crearla.
+func (h *OrderHandler) QuoteOrder(w http.ResponseWriter, r *http.Request) {
+	var order models.Order
+	if !decodeRequest(w, r, &order) {
+		return
+	}
+
+	if err := h.prepareOrder(&order); err != nil {
+		writePrepareOrderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Items          []models.OrderItem `json:"items"`
+		ZoneID         *int               `json:"zoneId,omitempty"`
+		PriceBreakdown *pricing.Breakdown `json:"priceBreakdown"`
+	}{order.Items, order.ZoneID, order.PriceBreakdown})
 }
 
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	var order models.Order
-	err := json.NewDecoder(r.Body).Decode(&order)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeRequest(w, r, &order) {
 		return
 	}
 
-	
-	if order.Title == "" || order.Description == "" || order.EstablishmentName == "" {
-		http.Error(w, "Faltan campos requeridos", http.StatusBadRequest)
+	if err := h.placeOrder(&order); err != nil {
+		writePlaceOrderError(w, err)
 		return
 	}
 
-	
-	if order.UserID == 0 {
-		order.UserID = 1
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, order.Version)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// placeOrder valida, tarifica y persiste una orden nueva, autoriza su pago
+// y avisa al cliente y a los repartidores. La usan tanto CreateOrder como
+// la repetición de órdenes y las plantillas recurrentes.
+func (h *OrderHandler) placeOrder(order *models.Order) error {
+	if err := h.prepareOrder(order); err != nil {
+		return err
 	}
 
+	// Las órdenes programadas esperan al planificador antes de pasar a
+	// "pending" y quedar visibles para los repartidores
 	order.Status = "pending"
+	if order.ScheduledFor != nil {
+		order.Status = "scheduled"
+	}
+	// El repartidor se asigna después, con las comprobaciones de
+	// disponibilidad y capacidad; no se acepta del cliente
+	order.DeliveryID = nil
+	order.EstimatedPickupAt, order.EstimatedDeliveryAt = nil, nil
 	order.CreatedAt = time.Now()
 	order.UpdatedAt = time.Now()
 
-	result, err := h.DB.Exec(
+	estLat, estLng := pointArgs(order.EstablishmentLocation)
+	delLat, delLng := pointArgs(order.DeliveryLocation)
+	var estStreet, estCity, estPostalCode, estNotes interface{}
+	if d := order.EstablishmentAddressDetails; d != nil {
+		estStreet, estCity, estPostalCode, estNotes = d.Street, d.City, d.PostalCode, d.Notes
+	}
+	breakdown := order.PriceBreakdown
+	var promoCode interface{}
+	if order.PromoCode != "" {
+		promoCode = order.PromoCode
+	}
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		`INSERT INTO orders (title, description, status, establishmentName, 
-			establishmentAddress, price, user_id, delivery_id, created_at, updated_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			establishmentAddress, price, user_id, delivery_id, created_at, updated_at,
+			establishment_lat, establishment_lng, delivery_lat, delivery_lng,
+			establishment_street, establishment_city, establishment_postal_code, establishment_notes,
+			zone_id, establishment_id, subtotal, delivery_fee, service_fee, tax, surge_multiplier,
+			promo_code, discount, tip, scheduled_for) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		order.Title, order.Description, order.Status, order.EstablishmentName,
 		order.EstablishmentAddr, order.Price, order.UserID, order.DeliveryID, 
-		order.CreatedAt, order.UpdatedAt,
+		order.CreatedAt, order.UpdatedAt, estLat, estLng, delLat, delLng,
+		estStreet, estCity, estPostalCode, estNotes, order.ZoneID, order.EstablishmentID,
+		breakdown.Subtotal, breakdown.DeliveryFee, breakdown.ServiceFee, breakdown.Tax, breakdown.SurgeMultiplier,
+		promoCode, breakdown.Discount, order.Tip, order.ScheduledFor,
 	)
 	if err != nil {
-		http.Error(w, "Error al crear orden: "+err.Error(), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("Error al crear orden: %w", err)
 	}
 
 	id, _ := result.LastInsertId()
 	order.ID = int(id)
+	if err := insertOrderItems(tx, order.ID, order.Items); err != nil {
+		return fmt.Errorf("Error al crear orden: %w", err)
+	}
+	if order.PromoCode != "" {
+		if err := redeemPromotion(tx, order); err != nil {
+			return err
+		}
+	}
+	paymentRef, err := authorizePayment(tx, h.Payments, order)
+	if err == payments.ErrDeclined {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("Error al autorizar el pago: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		if paymentRef != "" {
+			h.Payments.Void(paymentRef)
+		}
+		return err
+	}
+	order.Version = 1
+	if order.Status == "pending" {
+		refreshOrderETA(h.DB, h.ETA, order)
+	}
 
-	// Notificar al cliente
-	h.SSEManager.NotifyOrderUpdate(&order)
+	// Notificar al cliente y publicar la orden en la bolsa de repartidores
+	h.SSEManager.NotifyOrderUpdate(order)
+	if order.Status == "pending" && order.DeliveryID == nil {
+		notifyCouriers(h.DB, h.SSEManager, "order_available", *order, 0)
+	}
+	return nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(order)
+func writePlaceOrderError(w http.ResponseWriter, err error) {
+	if err == payments.ErrDeclined {
+		apierror.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	}
+	writePrepareOrderError(w, err)
+}
+
+var orderSortFields = map[string]sortField{
+	"createdAt": {column: "created_at", parse: parseTimeValue},
+	"price":     {column: "price", parse: parseMoneyValue},
 }
 
 func (h *OrderHandler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.Query(`
-		SELECT id, title, description, status, establishmentName, 
-			   establishmentAddress, price, user_id, delivery_id, created_at, updated_at 
-		FROM orders ORDER BY created_at DESC`)
+	query := r.URL.Query()
+	page, err := parsePageParams(query, orderSortFields)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filters := &listQuery{}
+	filters.add("deleted_at IS NULL")
+	if v := query.Get("status"); v != "" {
+		filters.add("status = ?", v)
+	}
+	if v := query.Get("deliveryId"); v != "" {
+		deliveryId, err := strconv.Atoi(v)
+		if err != nil {
+			apierror.Error(w, "deliveryId inválido", http.StatusBadRequest)
+			return
+		}
+		filters.add("delivery_id = ?", deliveryId)
+	}
+	if v := query.Get("userId"); v != "" {
+		userId, err := strconv.Atoi(v)
+		if err != nil {
+			apierror.Error(w, "userId inválido", http.StatusBadRequest)
+			return
+		}
+		filters.add("user_id = ?", userId)
+	}
+	if v := query.Get("zoneId"); v != "" {
+		zoneId, err := strconv.Atoi(v)
+		if err != nil {
+			apierror.Error(w, "zoneId inválido", http.StatusBadRequest)
+			return
+		}
+		filters.add("zone_id = ?", zoneId)
+	}
+	if v := query.Get("establishmentId"); v != "" {
+		establishmentId, err := strconv.Atoi(v)
+		if err != nil {
+			apierror.Error(w, "establishmentId inválido", http.StatusBadRequest)
+			return
+		}
+		filters.add("establishment_id = ?", establishmentId)
+	}
+	if v := query.Get("establishment"); v != "" {
+		filters.add("establishmentName LIKE ?", "%"+v+"%")
+	}
+	if v := query.Get("minPrice"); v != "" {
+		minPrice, err := money.Parse(v)
+		if err != nil {
+			apierror.Error(w, "minPrice inválido", http.StatusBadRequest)
+			return
+		}
+		filters.add("price >= ?", minPrice)
+	}
+	if v := query.Get("maxPrice"); v != "" {
+		maxPrice, err := money.Parse(v)
+		if err != nil {
+			apierror.Error(w, "maxPrice inválido", http.StatusBadRequest)
+			return
+		}
+		filters.add("price <= ?", maxPrice)
+	}
+	if v := query.Get("from"); v != "" {
+		from, err := parseDateParam(v)
+		if err != nil {
+			apierror.Error(w, "from debe ser una fecha RFC3339 o YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filters.add("created_at >= ?", from)
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := parseDateParam(v)
+		if err != nil {
+			apierror.Error(w, "to debe ser una fecha RFC3339 o YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		// Una fecha sin hora incluye el día completo
+		if len(v) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+		filters.add("created_at < ?", to)
+	}
+
+	var total int
+	err = h.DB.QueryRow("SELECT COUNT(*) FROM orders"+filters.where(), filters.args...).Scan(&total)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	orderBy, err := page.apply(filters)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT "+orderColumns+" FROM orders"+filters.where()+orderBy, filters.args...)
+	if err != nil {
+		apierror.Internal(w, err)
 		return
 	}
 	defer rows.Close()
 
-	var orders []models.Order
+	orders := []models.Order{}
 	for rows.Next() {
 		var order models.Order
-		err := rows.Scan(&order.ID, &order.Title, &order.Description, &order.Status,
-			&order.EstablishmentName, &order.EstablishmentAddr, &order.Price,
-			&order.UserID, &order.DeliveryID, &order.CreatedAt, &order.UpdatedAt)
+		err := scanOrder(rows, &order)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Internal(w, err)
 			return
 		}
 		orders = append(orders, order)
 	}
 
+	response := Page{Total: total}
+	if len(orders) > page.limit {
+		orders = orders[:page.limit]
+		last := orders[len(orders)-1]
+		value := last.CreatedAt.Format(time.RFC3339Nano)
+		if page.sort == "price" {
+			value = last.Price.String()
+		}
+		response.NextCursor = page.nextCursor(value, last.ID)
+	}
+	response.Data = orders
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	json.NewEncoder(w).Encode(response)
 }
 
 func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userId, err := strconv.Atoi(vars["userId"])
 	if err != nil {
-		http.Error(w, "userId inválido", http.StatusBadRequest)
+		apierror.Error(w, "userId inválido", http.StatusBadRequest)
 		return
 	}
 
 	rows, err := h.DB.Query(`
-		SELECT id, title, description, status, establishmentName, 
-			   establishmentAddress, price, user_id, delivery_id, created_at, updated_at 
-		FROM orders WHERE user_id = ? OR delivery_id = ?
+		SELECT `+orderColumns+`
+		FROM orders WHERE (user_id = ? OR delivery_id = ?) AND deleted_at IS NULL
 		ORDER BY created_at DESC`, userId, userId)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Internal(w, err)
 		return
 	}
 	defer rows.Close()
@@ -114,11 +463,9 @@ func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 	var orders []models.Order
 	for rows.Next() {
 		var order models.Order
-		err := rows.Scan(&order.ID, &order.Title, &order.Description, &order.Status,
-			&order.EstablishmentName, &order.EstablishmentAddr, &order.Price,
-			&order.UserID, &order.DeliveryID, &order.CreatedAt, &order.UpdatedAt)
+		err := scanOrder(rows, &order)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Internal(w, err)
 			return
 		}
 		orders = append(orders, order)
@@ -132,24 +479,32 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "ID inválido", http.StatusBadRequest)
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
 		return
 	}
 
 	var order models.Order
-	err = h.DB.QueryRow(`
-		SELECT id, title, description, status, establishmentName, 
-			   establishmentAddress, price, user_id, delivery_id, created_at, updated_at 
-		FROM orders WHERE id = ?`, id,
-	).Scan(&order.ID, &order.Title, &order.Description, &order.Status, 
-		&order.EstablishmentName, &order.EstablishmentAddr, &order.Price, 
-		&order.UserID, &order.DeliveryID, &order.CreatedAt, &order.UpdatedAt)
+	err = scanOrder(h.DB.QueryRow(
+		"SELECT "+orderColumns+" FROM orders WHERE id = ? AND deleted_at IS NULL", id,
+	), &order)
 
 	if err == sql.ErrNoRows {
-		http.Error(w, "Orden no encontrada", http.StatusNotFound)
+		apierror.Error(w, "Orden no encontrada", http.StatusNotFound)
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Internal(w, err)
+		return
+	}
+
+	setETag(w, order.Version)
+	if r.Header.Get("If-None-Match") == w.Header().Get("ETag") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	order.Items, err = loadOrderItems(h.DB, order.ID)
+	if err != nil {
+		apierror.Internal(w, err)
 		return
 	}
 
@@ -157,61 +512,119 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(order)
 }
 
-func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+// GetOrderTrail devuelve el recorrido del repartidor para la orden. Solo lo
+// ven el cliente de la orden, su repartidor y los administradores.
+func (h *OrderHandler) GetOrderTrail(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "ID inválido", http.StatusBadRequest)
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
 		return
 	}
 
-	var updateData struct {
-		Status string `json:"status"`
-		UserID int    `json:"userId"`
+	var customerId int
+	var deliveryId sql.NullInt64
+	err = h.DB.QueryRow(
+		"SELECT user_id, delivery_id FROM orders WHERE id = ? AND deleted_at IS NULL", id,
+	).Scan(&customerId, &deliveryId)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Orden no encontrada", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	userId, _ := r.Context().Value("user_id").(int)
+	role, _ := r.Context().Value("user_role").(string)
+	isCourier := deliveryId.Valid && int(deliveryId.Int64) == userId
+	if role != "admin" && userId != customerId && !isCourier {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
 	}
-	err = json.NewDecoder(r.Body).Decode(&updateData)
+
+	rows, err := h.DB.Query(
+		`SELECT t.lat, t.lng, t.recorded_at FROM order_location_trail t
+		 JOIN orders o ON o.id = t.order_id AND o.deleted_at IS NULL
+		 WHERE t.order_id = ? ORDER BY t.recorded_at ASC, t.id ASC`,
+		id,
+	)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Internal(w, err)
 		return
 	}
+	defer rows.Close()
 
-	
-	validStatus := map[string]bool{
-		"pending": true, "pickup": true, "in_coming": true, 
-		"arrived": true, "delivered": true,
+	trail := []models.LocationPoint{}
+	for rows.Next() {
+		point := models.LocationPoint{OrderID: id}
+		err := rows.Scan(&point.Lat, &point.Lng, &point.RecordedAt)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		trail = append(trail, point)
 	}
-	if !validStatus[updateData.Status] {
-		http.Error(w, "Status inválido", http.StatusBadRequest)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trail)
+}
+
+func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
 		return
 	}
 
-	
-	_, err = h.DB.Exec(
-		"UPDATE orders SET status = ?, updated_at = ? WHERE id = ?",
-		updateData.Status, time.Now(), id,
-	)
+	version, err := parseIfMatch(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	
-	var updatedOrder models.Order
-	err = h.DB.QueryRow(`
-		SELECT id, title, description, status, establishmentName, 
-			   establishmentAddress, price, user_id, delivery_id, created_at, updated_at 
-		FROM orders WHERE id = ?`, id,
-	).Scan(&updatedOrder.ID, &updatedOrder.Title, &updatedOrder.Description, 
-		&updatedOrder.Status, &updatedOrder.EstablishmentName, 
-		&updatedOrder.EstablishmentAddr, &updatedOrder.Price, 
-		&updatedOrder.UserID, &updatedOrder.DeliveryID, 
-		&updatedOrder.CreatedAt, &updatedOrder.UpdatedAt)
+	var updateData struct {
+		Status string `json:"status" validate:"required,oneof=pickup in_coming arrived delivered cancelled"`
+		UserID int    `json:"userId"`
+	}
+	if !decodeRequest(w, r, &updateData) {
+		return
+	}
 
-	if err == nil {
-		h.SSEManager.NotifyOrderUpdate(&updatedOrder)
+	// Solo se avanza por orderTransitions: una orden entregada o cancelada
+	// no vuelve atrás, y su pago y la ganancia del repartidor no cambian
+	where, whereArgs, ok := transitionCondition(updateData.Status)
+	if !ok {
+		writeOrderUpdateError(w, errOrderPrecondition)
+		return
+	}
+	set, setArgs := "status = ?", []interface{}{updateData.Status}
+	if updateData.Status == "delivered" {
+		set += ", delivered_at = COALESCE(delivered_at, ?)"
+		setArgs = append(setArgs, time.Now())
+	}
+
+	updatedOrder, err := updateOrder(h.DB, id, orderUpdate{
+		Set:       set,
+		SetArgs:   setArgs,
+		Where:     where,
+		WhereArgs: whereArgs,
+		Version:   version,
+	})
+	if err != nil {
+		writeOrderUpdateError(w, err)
+		return
 	}
 
+	settlePayment(h.DB, h.Payments, &updatedOrder)
+	recordCourierEarning(h.DB, h.Earnings, &updatedOrder)
+
+	refreshOrderETA(h.DB, h.ETA, &updatedOrder)
+	h.SSEManager.NotifyOrderUpdate(&updatedOrder)
+
 	w.Header().Set("Content-Type", "application/json")
+	setETag(w, updatedOrder.Version)
 	json.NewEncoder(w).Encode(updatedOrder)
 }
 
@@ -219,82 +632,213 @@ func (h *OrderHandler) AssignDelivery(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "ID inválido", http.StatusBadRequest)
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	var assignData struct {
-		DeliveryID int `json:"deliveryId"`
+		DeliveryID int `json:"deliveryId" validate:"required"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&assignData)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeRequest(w, r, &assignData) {
 		return
 	}
 
 	// Verificar que el delivery exista
 	var role string
-	err = h.DB.QueryRow("SELECT role FROM users WHERE id = ?", assignData.DeliveryID).Scan(&role)
+	err = h.DB.QueryRow("SELECT role FROM users WHERE id = ? AND deleted_at IS NULL", assignData.DeliveryID).Scan(&role)
 	if err != nil || role != "delivery" {
-		http.Error(w, "Repartidor no válido", http.StatusBadRequest)
+		apierror.Error(w, "Repartidor no válido", http.StatusBadRequest)
 		return
 	}
 
 	// Asignar repartidor
-	_, err = h.DB.Exec(
-		"UPDATE orders SET delivery_id = ?, status = 'pickup', updated_at = ? WHERE id = ?",
-		assignData.DeliveryID, time.Now(), id,
-	)
+	updatedOrder, err := updateOrder(h.DB, id, orderUpdate{
+		Set:       "delivery_id = ?, status = 'pickup'",
+		SetArgs:   []interface{}{assignData.DeliveryID},
+		Where:     "status IN ('pending', 'pickup')",
+		Version:   version,
+		CourierID: assignData.DeliveryID,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeOrderUpdateError(w, err)
 		return
 	}
 
-	
-	var updatedOrder models.Order
-	err = h.DB.QueryRow(`
-		SELECT id, title, description, status, establishmentName, 
-			   establishmentAddress, price, user_id, delivery_id, created_at, updated_at 
-		FROM orders WHERE id = ?`, id,
-	).Scan(&updatedOrder.ID, &updatedOrder.Title, &updatedOrder.Description, 
-		&updatedOrder.Status, &updatedOrder.EstablishmentName, 
-		&updatedOrder.EstablishmentAddr, &updatedOrder.Price, 
-		&updatedOrder.UserID, &updatedOrder.DeliveryID, 
-		&updatedOrder.CreatedAt, &updatedOrder.UpdatedAt)
+	refreshOrderETA(h.DB, h.ETA, &updatedOrder)
+	h.SSEManager.NotifyOrderUpdate(&updatedOrder)
+	notifyCouriers(h.DB, h.SSEManager, "order_claimed", map[string]int{"id": id}, assignData.DeliveryID)
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, updatedOrder.Version)
+	json.NewEncoder(w).Encode(updatedOrder)
+}
 
-	if err == nil {
-		h.SSEManager.NotifyOrderUpdate(&updatedOrder)
+// ClaimOrder permite al repartidor autenticado tomar una orden pendiente.
+// El UPDATE condicional garantiza que solo un repartidor gane la orden.
+func (h *OrderHandler) ClaimOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
 	}
 
+	courierId, _ := r.Context().Value("user_id").(int)
+	claimedOrder, err := updateOrder(h.DB, id, orderUpdate{
+		Set:       "delivery_id = ?, status = 'pickup'",
+		SetArgs:   []interface{}{courierId},
+		Where:     "status = 'pending' AND delivery_id IS NULL",
+		CourierID: courierId,
+	})
+	if err == errOrderPrecondition {
+		apierror.Error(w, "La orden ya fue tomada", http.StatusConflict)
+		return
+	} else if err != nil {
+		writeOrderUpdateError(w, err)
+		return
+	}
+
+	refreshOrderETA(h.DB, h.ETA, &claimedOrder)
+	h.SSEManager.NotifyOrderUpdate(&claimedOrder)
+	notifyCouriers(h.DB, h.SSEManager, "order_claimed", map[string]int{"id": id}, courierId)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedOrder)
+	setETag(w, claimedOrder.Version)
+	json.NewEncoder(w).Encode(claimedOrder)
+}
+
+// AcceptOffer confirma la oferta enviada por el motor de despacho.
+func (h *OrderHandler) AcceptOffer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	courierId, _ := r.Context().Value("user_id").(int)
+	if !h.Dispatcher.Accept(id, courierId) {
+		apierror.Error(w, "No tienes una oferta vigente para esta orden", http.StatusConflict)
+		return
+	}
+
+	// Si el repartidor ya no tiene capacidad la orden sigue pendiente y el
+	// motor la ofrece de nuevo en la siguiente ronda
+	acceptedOrder, err := updateOrder(h.DB, id, orderUpdate{
+		Set:       "delivery_id = ?, status = 'pickup'",
+		SetArgs:   []interface{}{courierId},
+		Where:     "status = 'pending' AND delivery_id IS NULL",
+		CourierID: courierId,
+	})
+	if err == errOrderPrecondition {
+		apierror.Error(w, "La orden ya fue tomada", http.StatusConflict)
+		return
+	} else if err != nil {
+		writeOrderUpdateError(w, err)
+		return
+	}
+
+	refreshOrderETA(h.DB, h.ETA, &acceptedOrder)
+	h.SSEManager.NotifyOrderUpdate(&acceptedOrder)
+	notifyCouriers(h.DB, h.SSEManager, "order_claimed", map[string]int{"id": id}, courierId)
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, acceptedOrder.Version)
+	json.NewEncoder(w).Encode(acceptedOrder)
+}
+
+func (h *OrderHandler) DeclineOffer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	courierId, _ := r.Context().Value("user_id").(int)
+	if !h.Dispatcher.Decline(id, courierId) {
+		apierror.Error(w, "No tienes una oferta vigente para esta orden", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "ID inválido", http.StatusBadRequest)
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
 		return
 	}
 
-	
-	var order models.Order
-	h.DB.QueryRow("SELECT user_id, delivery_id FROM orders WHERE id = ?", id).Scan(&order.UserID, &order.DeliveryID)
+	version, err := parseIfMatch(r)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	_, err = h.DB.Exec("DELETE FROM orders WHERE id = ?", id)
+	// Borrado lógico: la fila se elimina definitivamente en la purga
+	order, err := updateOrder(h.DB, id, orderUpdate{
+		Set:     "deleted_at = ?",
+		SetArgs: []interface{}{time.Now()},
+		Version: version,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeOrderUpdateError(w, err)
 		return
 	}
 
-	
-	if order.UserID != 0 {
-		h.SSEManager.NotifyUser(order.UserID, "order_deleted", map[string]int{"id": id})
+	// Una orden borrada antes de entregarse ya no se cobrará: se libera la
+	// retención igual que al cancelarla
+	if order.Status != "delivered" {
+		settleAuthorized(h.DB, h.Payments, order.ID, false)
 	}
+	h.SSEManager.NotifyUser(order.UserID, "order_deleted", map[string]int{"id": id})
 	if order.DeliveryID != nil {
 		h.SSEManager.NotifyUser(*order.DeliveryID, "order_deleted", map[string]int{"id": id})
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+func (h *OrderHandler) RestoreOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.DB.Exec(
+		"UPDATE orders SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL",
+		id,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Orden eliminada no encontrada", http.StatusNotFound)
+		return
+	}
+
+	var order models.Order
+	err = scanOrder(h.DB.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ?", id), &order)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	h.SSEManager.NotifyOrderUpdate(&order)
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, order.Version)
+	json.NewEncoder(w).Encode(order)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"deliveryService/models"
+	"deliveryService/payments"
+)
+
+var (
+	errScheduleTooSoon = errors.New("La hora programada no deja tiempo suficiente para preparar la orden")
+	errScheduleTooFar  = errors.New("La hora programada supera el máximo permitido")
+)
+
+// validateSchedule comprueba que la hora programada caiga dentro de la
+// ventana admitida. Se normaliza a la hora local del servidor porque el
+// horario de los establecimientos está expresado en ella.
+func (h *OrderHandler) validateSchedule(order *models.Order, now time.Time) error {
+	if order.ScheduledFor == nil {
+		return nil
+	}
+	at := order.ScheduledFor.Local()
+	order.ScheduledFor = &at
+	if at.Before(now.Add(h.ScheduleLead)) {
+		return errScheduleTooSoon
+	}
+	if h.ScheduleHorizon > 0 && at.After(now.Add(h.ScheduleHorizon)) {
+		return errScheduleTooFar
+	}
+	return nil
+}
+
+// OrderScheduler libera las órdenes programadas pasándolas a "pending"
+// cuando falta ScheduleLead para la hora pedida, momento a partir del cual
+// siguen el flujo normal de asignación. También ejecuta las plantillas
+// recurrentes, creando su orden programada TemplateAdvance antes de cada
+// ocurrencia; TemplateAdvance debe superar ScheduleLead. Además reintenta
+// los pagos que la pasarela no pudo capturar o anular.
+type OrderScheduler struct {
+	Orders          *OrderHandler
+	Interval        time.Duration
+	TemplateAdvance time.Duration
+}
+
+func (s *OrderScheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			s.RunTemplates()
+			s.Release()
+			settlePendingPayments(s.Orders.DB, s.Orders.Payments)
+			<-ticker.C
+		}
+	}()
+}
+
+func (s *OrderScheduler) Release() {
+	h := s.Orders
+	rows, err := h.DB.Query(
+		`SELECT id FROM orders
+		 WHERE status = 'scheduled' AND scheduled_for <= ? AND deleted_at IS NULL
+		 ORDER BY scheduled_for, id`,
+		time.Now().Add(h.ScheduleLead),
+	)
+	if err != nil {
+		log.Printf("Error obteniendo órdenes programadas: %v", err)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Printf("Error leyendo órdenes programadas: %v", err)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		// La condición sobre el estado evita liberar una orden que el
+		// cliente canceló entre la consulta y la actualización
+		order, err := updateOrder(h.DB, id, orderUpdate{
+			Set:   "status = 'pending'",
+			Where: "status = 'scheduled'",
+		})
+		if err == errOrderNotFound || err == errOrderPrecondition {
+			continue
+		} else if err != nil {
+			log.Printf("Error liberando la orden programada %d: %v", id, err)
+			continue
+		}
+
+		refreshOrderETA(h.DB, h.ETA, &order)
+		h.SSEManager.NotifyOrderUpdate(&order)
+		notifyCouriers(h.DB, h.SSEManager, "order_available", order, 0)
+		log.Printf("Orden programada %d liberada", id)
+	}
+}
+
+// RunTemplates crea las órdenes de las plantillas cuya próxima ocurrencia
+// entra en la ventana de antelación y confirma el resultado al cliente por
+// SSE. Una ocurrencia que ya no deja tiempo de preparación se omite.
+func (s *OrderScheduler) RunTemplates() {
+	h := s.Orders
+	now := time.Now()
+	rows, err := h.DB.Query(
+		"SELECT "+templateColumns+" FROM order_templates WHERE active = TRUE AND next_run_at <= ? ORDER BY next_run_at, id",
+		now.Add(s.TemplateAdvance),
+	)
+	if err != nil {
+		log.Printf("Error obteniendo plantillas recurrentes: %v", err)
+		return
+	}
+	var templates []models.OrderTemplate
+	for rows.Next() {
+		var t models.OrderTemplate
+		if err := scanTemplate(rows, &t); err != nil {
+			rows.Close()
+			log.Printf("Error leyendo plantillas recurrentes: %v", err)
+			return
+		}
+		templates = append(templates, t)
+	}
+	rows.Close()
+
+	for _, t := range templates {
+		runAt := *t.NextRunAt
+
+		// Avanzar next_run_at de forma condicional reserva la ocurrencia y
+		// evita crear la misma orden dos veces
+		var next interface{}
+		if n, ok := t.NextRunAfter(runAt); ok {
+			next = n
+		}
+		result, err := h.DB.Exec(
+			"UPDATE order_templates SET next_run_at = ? WHERE id = ? AND next_run_at = ?",
+			next, t.ID, runAt,
+		)
+		if err != nil {
+			log.Printf("Error reservando la plantilla %d: %v", t.ID, err)
+			continue
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		if runAt.Before(now.Add(h.ScheduleLead)) {
+			h.SSEManager.NotifyUser(t.UserID, "recurring_order_skipped", map[string]interface{}{
+				"templateId":   t.ID,
+				"scheduledFor": runAt,
+			})
+			log.Printf("Ocurrencia de la plantilla %d omitida: sin tiempo de preparación", t.ID)
+			continue
+		}
+
+		establishmentId := t.EstablishmentID
+		order := models.Order{
+			Title:            t.Title,
+			UserID:           t.UserID,
+			EstablishmentID:  &establishmentId,
+			Items:            append([]models.OrderItem{}, t.Items...),
+			DeliveryLocation: t.DeliveryLocation,
+			Tip:              t.Tip,
+			ScheduledFor:     &runAt,
+		}
+		if err := h.placeOrder(&order); err != nil {
+			h.SSEManager.NotifyUser(t.UserID, "recurring_order_failed", map[string]interface{}{
+				"templateId":   t.ID,
+				"scheduledFor": runAt,
+				"error":        templateErrorMessage(err),
+			})
+			log.Printf("Error ejecutando la plantilla %d: %v", t.ID, err)
+			continue
+		}
+
+		h.DB.Exec("UPDATE order_templates SET last_order_id = ? WHERE id = ?", order.ID, t.ID)
+		h.SSEManager.NotifyUser(t.UserID, "recurring_order_created", map[string]interface{}{
+			"templateId": t.ID,
+			"order":      order,
+		})
+	}
+}
+
+// templateErrorMessage devuelve el motivo que se comunica al cliente cuando
+// falla una plantilla. Solo los errores de validación conocidos se envían
+// tal cual; el resto, como los de la base de datos, se queda en el log.
+func templateErrorMessage(err error) string {
+	switch err {
+	case payments.ErrDeclined,
+		errCoverageLocationsRequired, errOutOfCoverage, errInvalidTip, errScheduleTooSoon, errScheduleTooFar,
+		errEstablishmentUnavailable, errEstablishmentClosed, errEstablishmentClosedAt, errOrderItemsRequired,
+		errMenuItemUnavailable, errModifierUnavailable,
+		errPromoInvalid, errPromoExpired, errPromoEstablishment, errPromoMinOrder, errPromoExhausted,
+		errPromoUserLimit, errPromoChanged:
+		return err.Error()
+	}
+	return "No se pudo crear la orden recurrente"
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import "strings"
+
+// orderStatusFlow es el orden de los estados de una orden. Los lotes usan
+// el mismo recorrido desde pickup.
+var orderStatusFlow = []string{"scheduled", "pending", "pickup", "in_coming", "arrived", "delivered", "cancelled"}
+
+// orderTransitions enumera los cambios de estado permitidos: el avance es
+// de un paso cada vez y solo se cancela antes de salir del establecimiento.
+// delivered y cancelled son definitivos. El paso de scheduled a pending
+// solo lo hace el planificador.
+var orderTransitions = map[string][]string{
+	"scheduled": {"cancelled"},
+	"pending":   {"pickup", "cancelled"},
+	"pickup":    {"in_coming", "cancelled"},
+	"in_coming": {"arrived"},
+	"arrived":   {"delivered"},
+}
+
+// canTransition indica si una orden (o un lote) puede pasar de from a to.
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionSources devuelve los estados desde los que se puede llegar a to.
+func transitionSources(to string) []string {
+	var sources []string
+	for _, from := range orderStatusFlow {
+		if canTransition(from, to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
+
+// transitionCondition devuelve la condición SQL que exige que la orden esté
+// en uno de los estados desde los que se llega a to. ok es false si no se
+// puede llegar a to desde ningún estado.
+func transitionCondition(to string) (where string, args []interface{}, ok bool) {
+	sources := transitionSources(to)
+	if len(sources) == 0 {
+		return "", nil, false
+	}
+	for _, from := range sources {
+		args = append(args, from)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(sources)), ", ")
+	return "status IN (" + placeholders + ")", args, true
+}
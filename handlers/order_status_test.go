@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"pending", "pickup", true},
+		{"pickup", "in_coming", true},
+		{"in_coming", "arrived", true},
+		{"arrived", "delivered", true},
+		{"scheduled", "cancelled", true},
+		{"pending", "cancelled", true},
+		{"pickup", "cancelled", true},
+		// Solo se avanza un paso y nunca hacia atrás
+		{"pending", "delivered", false},
+		{"pickup", "arrived", false},
+		{"arrived", "in_coming", false},
+		{"pickup", "pending", false},
+		// El paso de scheduled a pending es del planificador
+		{"scheduled", "pending", false},
+		// Tras salir del establecimiento ya no se cancela
+		{"in_coming", "cancelled", false},
+		{"arrived", "cancelled", false},
+		// Estados definitivos
+		{"delivered", "cancelled", false},
+		{"delivered", "arrived", false},
+		{"cancelled", "pending", false},
+		{"delivered", "delivered", false},
+		{"unknown", "pickup", false},
+	}
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionCondition(t *testing.T) {
+	tests := []struct {
+		to     string
+		where  string
+		args   []interface{}
+		wantOK bool
+	}{
+		{"pickup", "status IN (?)", []interface{}{"pending"}, true},
+		{"delivered", "status IN (?)", []interface{}{"arrived"}, true},
+		{"cancelled", "status IN (?, ?, ?)", []interface{}{"scheduled", "pending", "pickup"}, true},
+		{"pending", "", nil, false},
+		{"scheduled", "", nil, false},
+		{"unknown", "", nil, false},
+	}
+	for _, tt := range tests {
+		where, args, ok := transitionCondition(tt.to)
+		if where != tt.where || !reflect.DeepEqual(args, tt.args) || ok != tt.wantOK {
+			t.Errorf("transitionCondition(%q) = %q, %v, %v; want %q, %v, %v", tt.to, where, args, ok, tt.where, tt.args, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/models"
+)
+
+var (
+	errOrderNotFound     = errors.New("Orden no encontrada")
+	errVersionConflict   = errors.New("La orden fue modificada por otra petición")
+	errOrderPrecondition = errors.New("La orden no está en un estado válido para esta operación")
+)
+
+// orderUpdate describe una modificación sobre una orden. Where restringe el
+// estado actual (p.ej. "status = 'pending'") y Version, si es mayor que 0,
+// exige que la orden no haya cambiado desde que el cliente la leyó.
+// CourierID, si es mayor que 0, es el repartidor al que se asigna la orden:
+// su capacidad se verifica en la misma transacción.
+type orderUpdate struct {
+	Set       string
+	SetArgs   []interface{}
+	Where     string
+	WhereArgs []interface{}
+	Version   int
+	CourierID int
+}
+
+// updateOrder aplica la modificación, incrementa la versión y relee la orden
+// en la misma transacción, de modo que la respuesta refleja exactamente
+// esta escritura y no la de otra petición concurrente.
+func updateOrder(db *sql.DB, id int, u orderUpdate) (models.Order, error) {
+	var order models.Order
+
+	tx, err := db.Begin()
+	if err != nil {
+		return order, err
+	}
+	defer tx.Rollback()
+
+	if u.CourierID > 0 {
+		if err := checkCourierCapacity(tx, u.CourierID, 1); err != nil {
+			return order, err
+		}
+	}
+
+	query := "UPDATE orders SET " + u.Set + ", version = version + 1, updated_at = ? WHERE id = ? AND deleted_at IS NULL"
+	args := append(append([]interface{}{}, u.SetArgs...), time.Now(), id)
+	if u.Where != "" {
+		query += " AND " + u.Where
+		args = append(args, u.WhereArgs...)
+	}
+	if u.Version > 0 {
+		query += " AND version = ?"
+		args = append(args, u.Version)
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return order, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var version int
+		err = tx.QueryRow("SELECT version FROM orders WHERE id = ? AND deleted_at IS NULL", id).Scan(&version)
+		if err == sql.ErrNoRows {
+			return order, errOrderNotFound
+		} else if err != nil {
+			return order, err
+		}
+		if u.Version > 0 && version != u.Version {
+			return order, errVersionConflict
+		}
+		return order, errOrderPrecondition
+	}
+
+	err = scanOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ?", id), &order)
+	if err != nil {
+		return order, err
+	}
+	return order, tx.Commit()
+}
+
+func writeOrderUpdateError(w http.ResponseWriter, err error) {
+	switch err {
+	case errOrderNotFound:
+		apierror.Error(w, err.Error(), http.StatusNotFound)
+	case errVersionConflict:
+		apierror.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errOrderPrecondition, errCourierUnavailable, errCourierOverloaded:
+		apierror.Error(w, err.Error(), http.StatusConflict)
+	default:
+		apierror.Internal(w, err)
+	}
+}
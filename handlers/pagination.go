@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"deliveryService/money"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Page es el sobre de respuesta de los listados paginados.
+type Page struct {
+	Data       interface{} `json:"data"`
+	NextCursor *string     `json:"nextCursor"`
+	Total      int         `json:"total"`
+}
+
+// sortField describe una columna ordenable y cómo convertir el valor
+// guardado en el cursor al tipo de la columna.
+type sortField struct {
+	column string
+	parse  func(string) (interface{}, error)
+}
+
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+type pageParams struct {
+	limit  int
+	sort   string
+	field  sortField
+	desc   bool
+	cursor *cursor
+}
+
+// parsePageParams lee limit, sort y cursor de la query string. El orden por
+// defecto es -createdAt; el id desempata para que el cursor sea estable.
+func parsePageParams(q url.Values, fields map[string]sortField) (*pageParams, error) {
+	p := &pageParams{limit: defaultPageSize, sort: "createdAt", desc: true}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit debe ser un número positivo")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		p.limit = limit
+	}
+
+	if v := q.Get("sort"); v != "" {
+		p.desc = strings.HasPrefix(v, "-")
+		p.sort = strings.TrimPrefix(v, "-")
+	}
+	field, ok := fields[p.sort]
+	if !ok {
+		return nil, errors.New("sort inválido: " + p.sort)
+	}
+	p.field = field
+
+	if v := q.Get("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return nil, errors.New("cursor inválido")
+		}
+		var c cursor
+		if err := json.Unmarshal(raw, &c); err != nil || c.Sort != p.sort {
+			return nil, errors.New("cursor inválido")
+		}
+		p.cursor = &c
+	}
+
+	return p, nil
+}
+
+// apply añade la condición del cursor a la consulta y devuelve las cláusulas
+// ORDER BY y LIMIT. Se pide una fila extra para saber si hay página siguiente.
+func (p *pageParams) apply(q *listQuery) (string, error) {
+	op, dir := ">", "ASC"
+	if p.desc {
+		op, dir = "<", "DESC"
+	}
+
+	if p.cursor != nil {
+		value, err := p.field.parse(p.cursor.Value)
+		if err != nil {
+			return "", errors.New("cursor inválido")
+		}
+		col := p.field.column
+		q.add("("+col+" "+op+" ? OR ("+col+" = ? AND id "+op+" ?))", value, value, p.cursor.ID)
+	}
+
+	return " ORDER BY " + p.field.column + " " + dir + ", id " + dir +
+		" LIMIT " + strconv.Itoa(p.limit+1), nil
+}
+
+func (p *pageParams) nextCursor(value string, id int) *string {
+	raw, _ := json.Marshal(cursor{Sort: p.sort, Value: value, ID: id})
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	return &encoded
+}
+
+// listQuery acumula condiciones WHERE con sus argumentos.
+type listQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *listQuery) add(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+func (q *listQuery) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+func parseTimeValue(v string) (interface{}, error) {
+	return time.Parse(time.RFC3339Nano, v)
+}
+
+func parseMoneyValue(v string) (interface{}, error) {
+	return money.Parse(v)
+}
+
+func parseStringValue(v string) (interface{}, error) {
+	return v, nil
+}
+
+// parseDateParam acepta RFC3339 o una fecha simple YYYY-MM-DD (hora local).
+func parseDateParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, time.Local)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+
+	"deliveryService/models"
+	"deliveryService/payments"
+)
+
+// authorizePayment retiene el total de la orden en la pasarela y registra el
+// pago dentro de la transacción de creación. Devuelve la referencia para
+// poder anular la retención si la transacción no llega a confirmarse.
+func authorizePayment(tx *sql.Tx, provider payments.Provider, order *models.Order) (string, error) {
+	if order.Price <= 0 {
+		return "", nil
+	}
+
+	ref, err := provider.Authorize(order.Price, "order-"+strconv.Itoa(order.ID))
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO payments (order_id, provider, provider_reference, amount, status) VALUES (?, ?, ?, ?, 'authorized')",
+		order.ID, provider.Name(), ref, order.Price,
+	)
+	if err != nil {
+		provider.Void(ref)
+		return "", err
+	}
+	order.PaymentStatus = "authorized"
+	return ref, nil
+}
+
+// settlePayment captura el pago cuando la orden se entrega y lo anula cuando
+// se cancela. Si la pasarela falla el pago queda autorizado en una orden ya
+// cerrada, que es el estado que settlePendingPayments reintenta.
+func settlePayment(db *sql.DB, provider payments.Provider, order *models.Order) {
+	switch order.Status {
+	case "delivered":
+		if settleAuthorized(db, provider, order.ID, true) {
+			order.PaymentStatus = "captured"
+		}
+	case "cancelled":
+		if settleAuthorized(db, provider, order.ID, false) {
+			order.PaymentStatus = "voided"
+		}
+	}
+}
+
+// settlePendingPayments reintenta los pagos que siguen autorizados en
+// órdenes entregadas, canceladas o borradas: se captura el de las
+// entregadas y se anula el resto. Lo ejecuta OrderScheduler en cada ciclo.
+func settlePendingPayments(db *sql.DB, provider payments.Provider) {
+	rows, err := db.Query(
+		`SELECT DISTINCT o.id, o.status FROM payments p JOIN orders o ON o.id = p.order_id
+		 WHERE p.status = 'authorized'
+		 AND (o.status IN ('delivered', 'cancelled') OR o.deleted_at IS NOT NULL)`,
+	)
+	if err != nil {
+		log.Printf("Error obteniendo pagos pendientes de liquidar: %v", err)
+		return
+	}
+	var pending []models.Order
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(&order.ID, &order.Status); err != nil {
+			rows.Close()
+			log.Printf("Error leyendo pagos pendientes de liquidar: %v", err)
+			return
+		}
+		pending = append(pending, order)
+	}
+	rows.Close()
+
+	for _, order := range pending {
+		if settleAuthorized(db, provider, order.ID, order.Status == "delivered") {
+			log.Printf("Pago pendiente de la orden %d liquidado", order.ID)
+		}
+	}
+}
+
+// settleAuthorized captura (o anula) la autorización vigente de la orden.
+// Devuelve true si había una y la pasarela la aceptó; los fallos se
+// registran en el log y el pago queda autorizado.
+func settleAuthorized(db *sql.DB, provider payments.Provider, orderId int, capture bool) bool {
+	action, status := "anular", "voided"
+	if capture {
+		action, status = "capturar", "captured"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error al %s el pago de la orden %d: %v", action, orderId, err)
+		return false
+	}
+	defer tx.Rollback()
+
+	var payment models.Payment
+	err = tx.QueryRow(
+		`SELECT id, provider_reference, amount FROM payments
+		 WHERE order_id = ? AND status = 'authorized' ORDER BY id DESC LIMIT 1 FOR UPDATE`,
+		orderId,
+	).Scan(&payment.ID, &payment.ProviderReference, &payment.Amount)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		log.Printf("Error al %s el pago de la orden %d: %v", action, orderId, err)
+		return false
+	}
+
+	captured := payment.Amount
+	if capture {
+		err = provider.Capture(payment.ProviderReference, payment.Amount)
+	} else {
+		captured = 0
+		err = provider.Void(payment.ProviderReference)
+	}
+	if err != nil {
+		log.Printf("Error al %s el pago de la orden %d: %v", action, orderId, err)
+		return false
+	}
+
+	_, err = tx.Exec(
+		"UPDATE payments SET status = ?, captured_amount = ? WHERE id = ?",
+		status, captured, payment.ID,
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error al %s el pago de la orden %d: %v", action, orderId, err)
+		return false
+	}
+	return true
+}
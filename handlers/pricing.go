@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"database/sql"
+
+	"deliveryService/geo"
+	"deliveryService/models"
+	"deliveryService/pricing"
+)
+
+// quoteOrder calcula el desglose de precio a partir de las líneas ya
+// validadas contra el menú y el código promocional, y fija price al total.
+// El precio que envíe el cliente se ignora.
+func quoteOrder(db *sql.DB, cfg pricing.Config, order *models.Order, zone *models.Zone) error {
+	in := pricing.Input{Tip: order.Tip}
+	for _, item := range order.Items {
+		in.Subtotal += item.Total
+	}
+	if zone != nil {
+		in.ZoneFee = zone.DeliveryFee
+	}
+	if order.PromoCode != "" {
+		order.PromoCode = normalizeCode(order.PromoCode)
+		_, discount, err := checkPromotion(db, order, in.Subtotal, false)
+		if err != nil {
+			return err
+		}
+		in.Discount = discount
+	}
+	if order.EstablishmentLocation != nil && order.DeliveryLocation != nil {
+		km := geo.DistanceKm(*order.EstablishmentLocation, *order.DeliveryLocation)
+		in.DistanceKm = &km
+	}
+
+	// La demanda se mide con la bolsa de órdenes sin repartidor frente a
+	// los repartidores en línea
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM orders WHERE status = 'pending' AND delivery_id IS NULL AND deleted_at IS NULL",
+	).Scan(&in.Pending)
+	if err != nil {
+		return err
+	}
+	err = db.QueryRow(
+		"SELECT COUNT(*) FROM users WHERE role = 'delivery' AND availability = 'online' AND deleted_at IS NULL",
+	).Scan(&in.Couriers)
+	if err != nil {
+		return err
+	}
+
+	breakdown := cfg.Quote(in)
+	order.PriceBreakdown = &breakdown
+	order.Price = breakdown.Total
+	return nil
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/models"
+	"deliveryService/money"
+	"github.com/gorilla/mux"
+)
+
+type PromotionHandler struct {
+	DB *sql.DB
+}
+
+var (
+	errPromoInvalid       = errors.New("Código promocional inválido")
+	errPromoExpired       = errors.New("El código promocional no está vigente")
+	errPromoEstablishment = errors.New("El código promocional no aplica a este establecimiento")
+	errPromoMinOrder      = errors.New("El pedido no alcanza el mínimo del código promocional")
+	errPromoExhausted     = errors.New("El código promocional alcanzó su límite de usos")
+	errPromoUserLimit     = errors.New("Ya utilizó este código promocional el máximo de veces")
+	errPromoChanged       = errors.New("El descuento del código promocional cambió, vuelva a cotizar la orden")
+)
+
+// queryRower es la parte común de *sql.DB y *sql.Tx que usan las
+// validaciones, para repetirlas dentro de la transacción de creación.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const promotionColumns = `p.id, p.code, p.kind, p.value, p.min_order, p.max_uses, p.max_uses_per_user,
+	p.starts_at, p.ends_at, p.establishment_id, p.active, p.created_at,
+	(SELECT COUNT(*) FROM promotion_redemptions r WHERE r.promotion_id = p.id)`
+
+func scanPromotion(row rowScanner, p *models.Promotion) error {
+	return row.Scan(&p.ID, &p.Code, &p.Kind, &p.Value, &p.MinOrder, &p.MaxUses, &p.MaxUsesPerUser,
+		&p.StartsAt, &p.EndsAt, &p.EstablishmentID, &p.Active, &p.CreatedAt, &p.Uses)
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// checkPromotion valida el código para la orden y devuelve el descuento.
+// Con forUpdate bloquea la fila de la promoción, de modo que el conteo de
+// usos y el canje posterior sean atómicos dentro de la transacción.
+func checkPromotion(q queryRower, order *models.Order, subtotal money.Amount, forUpdate bool) (*models.Promotion, money.Amount, error) {
+	query := "SELECT " + promotionColumns + " FROM promotions p WHERE p.code = ?"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var promo models.Promotion
+	err := scanPromotion(q.QueryRow(query, normalizeCode(order.PromoCode)), &promo)
+	if err == sql.ErrNoRows {
+		return nil, 0, errPromoInvalid
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	if !promo.ActiveAt(time.Now()) {
+		return nil, 0, errPromoExpired
+	}
+	if promo.EstablishmentID != nil &&
+		(order.EstablishmentID == nil || *promo.EstablishmentID != *order.EstablishmentID) {
+		return nil, 0, errPromoEstablishment
+	}
+	if promo.MinOrder != nil && subtotal < *promo.MinOrder {
+		return nil, 0, errPromoMinOrder
+	}
+	if promo.MaxUses != nil && promo.Uses >= *promo.MaxUses {
+		return nil, 0, errPromoExhausted
+	}
+	if promo.MaxUsesPerUser != nil {
+		var used int
+		err := q.QueryRow(
+			"SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?",
+			promo.ID, order.UserID,
+		).Scan(&used)
+		if err != nil {
+			return nil, 0, err
+		}
+		if used >= *promo.MaxUsesPerUser {
+			return nil, 0, errPromoUserLimit
+		}
+	}
+
+	return &promo, promo.Discount(subtotal), nil
+}
+
+// redeemPromotion vuelve a validar el código con la fila bloqueada y
+// registra el uso. Si otro pedido agotó el código o la promoción cambió
+// entre la cotización y la creación, devuelve el error: la orden ya se
+// guardó con el descuento cotizado y no puede quedar con uno distinto.
+func redeemPromotion(tx *sql.Tx, order *models.Order) error {
+	promo, discount, err := checkPromotion(tx, order, order.PriceBreakdown.Subtotal, true)
+	if err != nil {
+		return err
+	}
+	if discount != order.PriceBreakdown.Discount {
+		return errPromoChanged
+	}
+	_, err = tx.Exec(
+		"INSERT INTO promotion_redemptions (promotion_id, user_id, order_id) VALUES (?, ?, ?)",
+		promo.ID, order.UserID, order.ID,
+	)
+	return err
+}
+
+func writePromotionError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case errPromoInvalid, errPromoExpired, errPromoEstablishment, errPromoMinOrder, errPromoUserLimit:
+		apierror.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errPromoExhausted, errPromoChanged:
+		apierror.Error(w, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+func validatePromotion(p *models.Promotion) error {
+	p.Code = normalizeCode(p.Code)
+	if p.Code == "" {
+		return errors.New("El código es requerido")
+	}
+	switch p.Kind {
+	case "percentage":
+		if p.Value <= 0 || p.Value > 10000 {
+			return errors.New("El porcentaje debe estar entre 0 y 100")
+		}
+	case "fixed":
+		if p.Value <= 0 {
+			return errors.New("El descuento fijo debe ser positivo")
+		}
+	default:
+		return errors.New("Tipo de promoción inválido. Debe ser 'percentage' o 'fixed'")
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return errors.New("endsAt debe ser posterior a startsAt")
+	}
+	if (p.MaxUses != nil && *p.MaxUses < 1) || (p.MaxUsesPerUser != nil && *p.MaxUsesPerUser < 1) {
+		return errors.New("Los límites de uso deben ser positivos")
+	}
+	return nil
+}
+
+func promotionArgs(p *models.Promotion) []interface{} {
+	return []interface{}{p.Code, p.Kind, p.Value, p.MinOrder, p.MaxUses, p.MaxUsesPerUser,
+		p.StartsAt, p.EndsAt, p.EstablishmentID, p.Active}
+}
+
+func (h *PromotionHandler) loadPromotion(id int) (models.Promotion, error) {
+	var promo models.Promotion
+	err := scanPromotion(h.DB.QueryRow("SELECT "+promotionColumns+" FROM promotions p WHERE p.id = ?", id), &promo)
+	return promo, err
+}
+
+func (h *PromotionHandler) GetPromotions(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query("SELECT " + promotionColumns + " FROM promotions p ORDER BY p.id DESC")
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		var promo models.Promotion
+		if err := scanPromotion(rows, &promo); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		promotions = append(promotions, promo)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotions)
+}
+
+func (h *PromotionHandler) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	promo := models.Promotion{Active: true}
+	if !decodeRequest(w, r, &promo) {
+		return
+	}
+	if err := validatePromotion(&promo); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Un código repetido choca con UNIQUE(code) y se responde como 409
+	result, err := h.DB.Exec(
+		`INSERT INTO promotions (code, kind, value, min_order, max_uses, max_uses_per_user,
+			starts_at, ends_at, establishment_id, active)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		promotionArgs(&promo)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	promo, err = h.loadPromotion(int(id))
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(promo)
+}
+
+func (h *PromotionHandler) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	promo := models.Promotion{Active: true}
+	if !decodeRequest(w, r, &promo) {
+		return
+	}
+	if err := validatePromotion(&promo); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.DB.Exec(
+		`UPDATE promotions SET code = ?, kind = ?, value = ?, min_order = ?, max_uses = ?,
+			max_uses_per_user = ?, starts_at = ?, ends_at = ?, establishment_id = ?, active = ?
+		 WHERE id = ?`,
+		append(promotionArgs(&promo), id)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Promoción no encontrada", http.StatusNotFound)
+		return
+	}
+
+	promo, err = h.loadPromotion(id)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promo)
+}
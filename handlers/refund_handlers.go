@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"deliveryService/apierror"
+	"deliveryService/models"
+	"deliveryService/money"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errRefundNotDelivered = errors.New("Solo se pueden reembolsar órdenes entregadas")
+	errRefundNoPayment    = errors.New("La orden no tiene un pago capturado")
+	errRefundExceeded     = errors.New("El reembolso supera el importe disponible")
+)
+
+const refundColumns = "id, order_id, payment_id, amount, reason, notes, status, provider_reference, created_by, created_at"
+
+func scanRefund(row rowScanner, refund *models.Refund) error {
+	var notes, providerRef sql.NullString
+	err := row.Scan(&refund.ID, &refund.OrderID, &refund.PaymentID, &refund.Amount, &refund.Reason,
+		&notes, &refund.Status, &providerRef, &refund.CreatedBy, &refund.CreatedAt)
+	refund.Notes = notes.String
+	refund.ProviderReference = providerRef.String
+	return err
+}
+
+// refundPart es la porción de un reembolso que se devuelve sobre un pago.
+type refundPart struct {
+	Payment models.Payment
+	Amount  money.Amount
+}
+
+// allocateRefund reparte el reembolso entre los pagos capturados de la
+// orden, del más antiguo al más reciente: primero el pago de la orden y
+// después las propinas añadidas tras la entrega. Sin amount se reembolsa
+// todo el saldo. Devuelve también el saldo disponible.
+func allocateRefund(captured []models.Payment, amount *money.Amount) ([]refundPart, money.Amount, error) {
+	var available money.Amount
+	for _, p := range captured {
+		available += p.CapturedAmount - p.RefundedAmount
+	}
+	remaining := available
+	if amount != nil {
+		remaining = *amount
+	}
+	if remaining <= 0 || remaining > available {
+		return nil, available, errRefundExceeded
+	}
+
+	var parts []refundPart
+	for _, p := range captured {
+		free := p.CapturedAmount - p.RefundedAmount
+		if free <= 0 {
+			continue
+		}
+		if free > remaining {
+			free = remaining
+		}
+		parts = append(parts, refundPart{Payment: p, Amount: free})
+		remaining -= free
+		if remaining == 0 {
+			break
+		}
+	}
+	return parts, available, nil
+}
+
+// CreateRefund devuelve al cliente parte o todo lo cobrado de una orden
+// entregada. Sin amount se reembolsa el saldo pendiente completo. Como la
+// orden puede tener varios pagos capturados, responde con un reembolso por
+// cada pago afectado.
+func (h *OrderHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderId, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	var refundData struct {
+		Amount *money.Amount `json:"amount" validate:"gt=0"`
+		Reason string        `json:"reason" validate:"required,oneof=missing_item wrong_item damaged late_delivery other"`
+		Notes  string        `json:"notes" validate:"max=1000"`
+	}
+	if !decodeRequest(w, r, &refundData) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var userId int
+	var status string
+	err = tx.QueryRow(
+		"SELECT user_id, status FROM orders WHERE id = ? AND deleted_at IS NULL", orderId,
+	).Scan(&userId, &status)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Orden no encontrada", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if status != "delivered" {
+		apierror.Error(w, errRefundNotDelivered.Error(), http.StatusConflict)
+		return
+	}
+
+	// Las filas de los pagos quedan bloqueadas hasta el commit, de modo que
+	// dos reembolsos simultáneos no pueden superar juntos lo capturado
+	rows, err := tx.Query(
+		`SELECT id, provider_reference, captured_amount, refunded_amount FROM payments
+		 WHERE order_id = ? AND status IN ('captured', 'partially_refunded', 'refunded')
+		 ORDER BY id FOR UPDATE`,
+		orderId,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	var captured []models.Payment
+	for rows.Next() {
+		var payment models.Payment
+		err := rows.Scan(&payment.ID, &payment.ProviderReference, &payment.CapturedAmount, &payment.RefundedAmount)
+		if err != nil {
+			rows.Close()
+			apierror.Internal(w, err)
+			return
+		}
+		captured = append(captured, payment)
+	}
+	rows.Close()
+	if len(captured) == 0 {
+		apierror.Error(w, errRefundNoPayment.Error(), http.StatusConflict)
+		return
+	}
+
+	parts, available, err := allocateRefund(captured, refundData.Amount)
+	if err != nil {
+		apierror.Error(w, err.Error()+" ("+available.String()+")", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// El importe se reserva en cada pago y los reembolsos quedan pendientes
+	// antes de llamar a la pasarela: si algo falla después, las filas siguen
+	// ahí para conciliarlas y el saldo no se puede gastar dos veces
+	createdBy, _ := r.Context().Value("user_id").(int)
+	var notes interface{}
+	if refundData.Notes != "" {
+		notes = refundData.Notes
+	}
+	refundIds := make([]int, len(parts))
+	for i, part := range parts {
+		result, err := tx.Exec(
+			`INSERT INTO refunds (order_id, payment_id, amount, reason, notes, status, created_by)
+			 VALUES (?, ?, ?, ?, ?, 'pending', ?)`,
+			orderId, part.Payment.ID, part.Amount, refundData.Reason, notes, createdBy,
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		_, err = tx.Exec(
+			`UPDATE payments SET refunded_amount = refunded_amount + ?,
+				status = IF(refunded_amount = captured_amount, 'refunded', 'partially_refunded')
+			 WHERE id = ?`,
+			part.Amount, part.Payment.ID,
+		)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		id, _ := result.LastInsertId()
+		refundIds[i] = int(id)
+	}
+	if err := tx.Commit(); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	// Si la pasarela rechaza una parte, esa y las siguientes se liberan; las
+	// ya devueltas se mantienen
+	failed := false
+	for i, part := range parts {
+		if failed {
+			failRefund(h.DB, refundIds[i], part.Payment.ID, part.Amount)
+			continue
+		}
+		providerRef, err := h.Payments.Refund(part.Payment.ProviderReference, part.Amount)
+		if err != nil {
+			log.Printf("Error al reembolsar %s de la orden %d: %v", part.Amount, orderId, err)
+			failRefund(h.DB, refundIds[i], part.Payment.ID, part.Amount)
+			failed = true
+			continue
+		}
+		_, err = h.DB.Exec(
+			"UPDATE refunds SET status = 'completed', provider_reference = ? WHERE id = ?",
+			providerRef, refundIds[i],
+		)
+		if err != nil {
+			// El dinero ya se devolvió: el reembolso queda pendiente y la
+			// referencia en el log para conciliarlo
+			log.Printf("Reembolso %d de la orden %d pendiente de conciliar (referencia %s): %v",
+				refundIds[i], orderId, providerRef, err)
+		}
+	}
+
+	refunds := make([]models.Refund, len(refundIds))
+	for i, id := range refundIds {
+		err := scanRefund(h.DB.QueryRow("SELECT "+refundColumns+" FROM refunds WHERE id = ?", id), &refunds[i])
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		if refunds[i].Status == "completed" {
+			h.SSEManager.NotifyUser(userId, "order_refunded", refunds[i])
+		}
+	}
+	if failed {
+		apierror.Write(w, http.StatusBadGateway, apierror.CodeFor(http.StatusBadGateway),
+			"La pasarela de pago no pudo procesar el reembolso", refunds)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(refunds)
+}
+
+// failRefund marca el reembolso como fallido y libera el importe reservado
+// en el pago.
+func failRefund(db *sql.DB, refundId, paymentId int, amount money.Amount) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error liberando el reembolso %d: %v", refundId, err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE refunds SET status = 'failed' WHERE id = ? AND status = 'pending'", refundId)
+	if err == nil {
+		_, err = tx.Exec(
+			`UPDATE payments SET refunded_amount = refunded_amount - ?,
+				status = IF(refunded_amount = 0, 'captured', 'partially_refunded')
+			 WHERE id = ?`,
+			amount, paymentId,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error liberando el reembolso %d: %v", refundId, err)
+	}
+}
+
+// GetRefunds devuelve el historial de reembolsos de la orden.
+func (h *OrderHandler) GetRefunds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderId, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT "+refundColumns+" FROM refunds WHERE order_id = ? ORDER BY id", orderId)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	refunds := []models.Refund{}
+	for rows.Next() {
+		var refund models.Refund
+		if err := scanRefund(rows, &refund); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		refunds = append(refunds, refund)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refunds)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"testing"
+
+	"deliveryService/models"
+	"deliveryService/money"
+)
+
+func TestAllocateRefund(t *testing.T) {
+	amount := func(a money.Amount) *money.Amount { return &a }
+	// Pago de la orden y propina añadida tras la entrega
+	order := models.Payment{ID: 1, CapturedAmount: 15000}
+	tip := models.Payment{ID: 2, CapturedAmount: 2000}
+	partial := models.Payment{ID: 1, CapturedAmount: 15000, RefundedAmount: 14000}
+	refunded := models.Payment{ID: 1, CapturedAmount: 15000, RefundedAmount: 15000}
+
+	type part struct {
+		paymentID int
+		amount    money.Amount
+	}
+	tests := []struct {
+		name          string
+		captured      []models.Payment
+		amount        *money.Amount
+		want          []part
+		wantAvailable money.Amount
+		wantErr       error
+	}{
+		{"saldo completo sin importe", []models.Payment{order, tip}, nil, []part{{1, 15000}, {2, 2000}}, 17000, nil},
+		{"parcial dentro del primer pago", []models.Payment{order, tip}, amount(5000), []part{{1, 5000}}, 17000, nil},
+		{"justo el primer pago", []models.Payment{order, tip}, amount(15000), []part{{1, 15000}}, 17000, nil},
+		{"se reparte del más antiguo al más reciente", []models.Payment{order, tip}, amount(16000), []part{{1, 15000}, {2, 1000}}, 17000, nil},
+		{"usa el saldo que queda de un pago", []models.Payment{partial, tip}, amount(1500), []part{{1, 1000}, {2, 500}}, 3000, nil},
+		{"omite pagos ya reembolsados", []models.Payment{refunded, tip}, amount(500), []part{{2, 500}}, 2000, nil},
+		{"supera el disponible", []models.Payment{order, tip}, amount(17001), nil, 17000, errRefundExceeded},
+		{"supera lo que queda", []models.Payment{partial}, amount(1001), nil, 1000, errRefundExceeded},
+		{"sin saldo disponible", []models.Payment{refunded}, nil, nil, 0, errRefundExceeded},
+		{"sin pagos", nil, amount(100), nil, 0, errRefundExceeded},
+		{"importe cero", []models.Payment{order}, amount(0), nil, 15000, errRefundExceeded},
+	}
+	for _, tt := range tests {
+		parts, available, err := allocateRefund(tt.captured, tt.amount)
+		if err != tt.wantErr || available != tt.wantAvailable {
+			t.Errorf("%s: allocateRefund error = %v, available = %s; want %v, %s", tt.name, err, available, tt.wantErr, tt.wantAvailable)
+			continue
+		}
+		got := make([]part, len(parts))
+		for i, p := range parts {
+			got[i] = part{p.Payment.ID, p.Amount}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: allocateRefund = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: allocateRefund = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"deliveryService/apierror"
+	"deliveryService/validation"
+)
+
+// decodeRequest decodifica y valida el cuerpo de la petición en dst. Si
+// falla responde con todos los campos inválidos y devuelve false.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	err := validation.Decode(w, r, dst)
+	switch e := err.(type) {
+	case nil:
+		return true
+	case validation.Errors:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeValidation, "La petición contiene campos inválidos", e)
+	default:
+		if err == validation.ErrBodyTooLarge {
+			apierror.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"deliveryService/apierror"
+	"deliveryService/models"
+	"deliveryService/money"
+	"github.com/gorilla/mux"
+)
+
+type ReviewHandler struct {
+	DB *sql.DB
+}
+
+const reviewColumns = `id, order_id, user_id, courier_id, establishment_id, courier_rating,
+	courier_comment, establishment_rating, establishment_comment, created_at`
+
+func scanReview(row rowScanner, review *models.Review) error {
+	var courierComment, establishmentComment sql.NullString
+	err := row.Scan(&review.ID, &review.OrderID, &review.UserID, &review.CourierID,
+		&review.EstablishmentID, &review.CourierRating, &courierComment,
+		&review.EstablishmentRating, &establishmentComment, &review.CreatedAt)
+	review.CourierComment = courierComment.String
+	review.EstablishmentComment = establishmentComment.String
+	return err
+}
+
+// loadRating devuelve la valoración media de un repartidor (target
+// "courier") o establecimiento (target "establishment"); nil si no tiene.
+func loadRating(db *sql.DB, target string, id int) (*models.Rating, error) {
+	var rating models.Rating
+	var average sql.NullFloat64
+	err := db.QueryRow(
+		"SELECT COUNT("+target+"_rating), AVG("+target+"_rating) FROM reviews WHERE "+target+"_id = ?",
+		id,
+	).Scan(&rating.Count, &average)
+	if err != nil || rating.Count == 0 {
+		return nil, err
+	}
+	rating.Average = roundRating(average.Float64)
+	return &rating, nil
+}
+
+// loadRatings devuelve las valoraciones de todos los repartidores o
+// establecimientos en una sola consulta, indexadas por id; los que no
+// tienen reseñas no aparecen.
+func loadRatings(db *sql.DB, target string) (map[int]*models.Rating, error) {
+	rows, err := db.Query(
+		"SELECT " + target + "_id, COUNT(" + target + "_rating), AVG(" + target + "_rating) FROM reviews" +
+			" WHERE " + target + "_id IS NOT NULL AND " + target + "_rating IS NOT NULL GROUP BY " + target + "_id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := map[int]*models.Rating{}
+	for rows.Next() {
+		var id int
+		var rating models.Rating
+		var average float64
+		if err := rows.Scan(&id, &rating.Count, &average); err != nil {
+			return nil, err
+		}
+		rating.Average = roundRating(average)
+		ratings[id] = &rating
+	}
+	return ratings, rows.Err()
+}
+
+func roundRating(average float64) float64 {
+	return math.Round(average*100) / 100
+}
+
+// CreateReview registra la valoración del cliente sobre su orden entregada.
+func (h *ReviewHandler) CreateReview(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderId, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	var review models.Review
+	if !decodeRequest(w, r, &review) {
+		return
+	}
+	if review.CourierRating == nil && review.EstablishmentRating == nil {
+		apierror.Error(w, "Se requiere al menos una valoración", http.StatusBadRequest)
+		return
+	}
+
+	var userId int
+	var status string
+	err = h.DB.QueryRow(
+		"SELECT user_id, status, delivery_id, establishment_id FROM orders WHERE id = ? AND deleted_at IS NULL",
+		orderId,
+	).Scan(&userId, &status, &review.CourierID, &review.EstablishmentID)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Orden no encontrada", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	if caller, _ := r.Context().Value("user_id").(int); caller != userId {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+	if status != "delivered" {
+		apierror.Error(w, "Solo se pueden valorar órdenes entregadas", http.StatusConflict)
+		return
+	}
+	if (review.CourierRating != nil && review.CourierID == nil) ||
+		(review.EstablishmentRating != nil && review.EstablishmentID == nil) {
+		apierror.Error(w, "La orden no tiene repartidor o establecimiento que valorar", http.StatusUnprocessableEntity)
+		return
+	}
+
+	nullable := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	result, err := h.DB.Exec(
+		`INSERT INTO reviews (order_id, user_id, courier_id, establishment_id, courier_rating,
+			courier_comment, establishment_rating, establishment_comment)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		orderId, userId, review.CourierID, review.EstablishmentID, review.CourierRating,
+		nullable(review.CourierComment), review.EstablishmentRating, nullable(review.EstablishmentComment),
+	)
+	// Una segunda valoración de la orden choca con UNIQUE(order_id) y se
+	// responde como 409
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	err = scanReview(h.DB.QueryRow("SELECT "+reviewColumns+" FROM reviews WHERE id = ?", id), &review)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+// GetEstablishmentReviews lista las valoraciones del establecimiento, las
+// más recientes primero.
+func (h *ReviewHandler) GetEstablishmentReviews(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(
+		"SELECT "+reviewColumns+` FROM reviews
+		 WHERE establishment_id = ? AND establishment_rating IS NOT NULL ORDER BY created_at DESC, id DESC`,
+		id,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		var review models.Review
+		if err := scanReview(rows, &review); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		// Solo la parte que corresponde al establecimiento es pública
+		review.CourierID, review.CourierRating, review.CourierComment = nil, nil, ""
+		reviews = append(reviews, review)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// GetCourierReport resume por repartidor su valoración, entregas y
+// ganancias, ordenado de peor a mejor valorado para detectar problemas.
+func (h *ReviewHandler) GetCourierReport(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(`
+		SELECT u.id, u.name,
+			(SELECT COUNT(r.courier_rating) FROM reviews r WHERE r.courier_id = u.id),
+			(SELECT AVG(r.courier_rating) FROM reviews r WHERE r.courier_id = u.id),
+			(SELECT COUNT(*) FROM orders o WHERE o.delivery_id = u.id AND o.status = 'delivered' AND o.deleted_at IS NULL),
+			(SELECT COALESCE(SUM(e.total), 0) FROM courier_earnings e WHERE e.courier_id = u.id)
+		FROM users u
+		WHERE u.role = 'delivery' AND u.deleted_at IS NULL`)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	type courierReport struct {
+		CourierID int            `json:"courierId"`
+		Name      string         `json:"name"`
+		Rating    *models.Rating `json:"rating"`
+		Delivered int            `json:"delivered"`
+		Earnings  money.Amount   `json:"earnings"`
+	}
+	report := []courierReport{}
+	for rows.Next() {
+		var c courierReport
+		var count int
+		var average sql.NullFloat64
+		if err := rows.Scan(&c.CourierID, &c.Name, &count, &average, &c.Delivered, &c.Earnings); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		if count > 0 {
+			c.Rating = &models.Rating{Average: roundRating(average.Float64), Count: count}
+		}
+		report = append(report, c)
+	}
+
+	// Sin valoraciones al final; el resto de peor a mejor
+	sort.SliceStable(report, func(i, j int) bool {
+		a, b := report[i].Rating, report[j].Rating
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Average < b.Average
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
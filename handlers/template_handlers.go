@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/models"
+	"deliveryService/money"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errTemplateSchedule     = errors.New("La plantilla requiere días entre 0 y 6 y una hora HH:MM válida")
+	errNotCatalogueOrder    = errors.New("La orden no pertenece a un establecimiento del catálogo")
+	errTemplateItemRequired = errors.New("La plantilla debe incluir al menos un producto con cantidad positiva")
+)
+
+// reorderItems convierte las líneas guardadas de una orden en líneas que
+// se pueden volver a pedir: solo producto, cantidad y modificadores, para
+// que los precios se recalculen con el menú vigente.
+func reorderItems(items []models.OrderItem) ([]models.OrderItem, error) {
+	result := make([]models.OrderItem, 0, len(items))
+	for _, item := range items {
+		if item.MenuItemID == 0 {
+			return nil, errMenuItemUnavailable
+		}
+		line := models.OrderItem{MenuItemID: item.MenuItemID, Quantity: item.Quantity}
+		for _, mod := range item.Modifiers {
+			// Las órdenes anteriores a los identificadores de modificador
+			// no se pueden reconstruir con fidelidad
+			if mod.ID == 0 {
+				return nil, errModifierUnavailable
+			}
+			line.ModifierIDs = append(line.ModifierIDs, mod.ID)
+		}
+		result = append(result, line)
+	}
+	return result, nil
+}
+
+// loadOwnOrder carga una orden comprobando que pertenezca al cliente.
+func loadOwnOrder(db *sql.DB, id, userId int) (models.Order, int, error) {
+	var order models.Order
+	err := scanOrder(db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ? AND deleted_at IS NULL", id), &order)
+	if err == sql.ErrNoRows {
+		return order, http.StatusNotFound, errOrderNotFound
+	} else if err != nil {
+		return order, http.StatusInternalServerError, err
+	}
+	if order.UserID != userId {
+		return order, http.StatusForbidden, errors.New("No tiene permisos para acceder")
+	}
+	if order.EstablishmentID == nil {
+		return order, http.StatusUnprocessableEntity, errNotCatalogueOrder
+	}
+
+	items, err := loadOrderItems(db, id)
+	if err != nil {
+		return order, http.StatusInternalServerError, err
+	}
+	order.Items, err = reorderItems(items)
+	if err != nil {
+		return order, http.StatusUnprocessableEntity, err
+	}
+	return order, 0, nil
+}
+
+// Reorder crea una orden nueva con los productos de una anterior a los
+// precios actuales del menú. Opcionalmente admite scheduledFor y tip.
+func (h *OrderHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	var options struct {
+		ScheduledFor *time.Time   `json:"scheduledFor"`
+		Tip          money.Amount `json:"tip" validate:"min=0"`
+	}
+	// El cuerpo es opcional
+	if r.ContentLength != 0 && !decodeRequest(w, r, &options) {
+		return
+	}
+
+	userId, _ := r.Context().Value("user_id").(int)
+	previous, status, err := loadOwnOrder(h.DB, id, userId)
+	if err != nil {
+		apierror.Status(w, err, status)
+		return
+	}
+
+	order := models.Order{
+		Title:            previous.Title,
+		UserID:           userId,
+		EstablishmentID:  previous.EstablishmentID,
+		Items:            previous.Items,
+		DeliveryLocation: previous.DeliveryLocation,
+		Tip:              options.Tip,
+		ScheduledFor:     options.ScheduledFor,
+	}
+	if err := h.placeOrder(&order); err != nil {
+		writePlaceOrderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, order.Version)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+const templateColumns = `id, user_id, establishment_id, title, items, delivery_lat, delivery_lng,
+	tip, days, run_time, active, next_run_at, last_order_id, created_at, updated_at`
+
+func scanTemplate(row rowScanner, t *models.OrderTemplate) error {
+	var items, days string
+	var lat, lng sql.NullFloat64
+	err := row.Scan(&t.ID, &t.UserID, &t.EstablishmentID, &t.Title, &items, &lat, &lng,
+		&t.Tip, &days, &t.Time, &t.Active, &t.NextRunAt, &t.LastOrderID, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	t.DeliveryLocation = nullPoint(lat, lng)
+	if err := json.Unmarshal([]byte(items), &t.Items); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(days), &t.Days)
+}
+
+func templateArgs(t *models.OrderTemplate) []interface{} {
+	items, _ := json.Marshal(t.Items)
+	days, _ := json.Marshal(t.Days)
+	lat, lng := pointArgs(t.DeliveryLocation)
+	return []interface{}{t.EstablishmentID, t.Title, string(items), lat, lng, t.Tip,
+		string(days), t.Time, t.Active, t.NextRunAt}
+}
+
+// validateTemplate comprueba la recurrencia y los productos contra el menú
+// vigente y calcula la próxima ejecución. El horario del establecimiento se
+// valida en cada ejecución, al crear la orden programada.
+func validateTemplate(db *sql.DB, t *models.OrderTemplate, now time.Time) error {
+	if t.Tip < 0 {
+		return errInvalidTip
+	}
+	seen := map[int]bool{}
+	for _, d := range t.Days {
+		if d < 0 || d > 6 || seen[d] {
+			return errTemplateSchedule
+		}
+		seen[d] = true
+	}
+	next, ok := t.NextRunAfter(now)
+	if !ok {
+		return errTemplateSchedule
+	}
+	t.NextRunAt = nil
+	if t.Active {
+		t.NextRunAt = &next
+	}
+
+	if len(t.Items) == 0 {
+		return errTemplateItemRequired
+	}
+	e, err := loadEstablishment(db, t.EstablishmentID)
+	if err == sql.ErrNoRows || (err == nil && !e.Active) {
+		return errEstablishmentUnavailable
+	} else if err != nil {
+		return err
+	}
+	menu, err := loadMenu(db, e.ID)
+	if err != nil {
+		return err
+	}
+	byId := make(map[int]models.MenuItem, len(menu))
+	for _, item := range menu {
+		byId[item.ID] = item
+	}
+	for i, line := range t.Items {
+		if line.Quantity < 1 {
+			return errTemplateItemRequired
+		}
+		item, ok := byId[line.MenuItemID]
+		if !ok {
+			return errMenuItemUnavailable
+		}
+		for _, modId := range line.ModifierIDs {
+			if _, ok := findModifier(item.Modifiers, modId); !ok {
+				return errModifierUnavailable
+			}
+		}
+		t.Items[i] = models.OrderItem{MenuItemID: line.MenuItemID, Quantity: line.Quantity, ModifierIDs: line.ModifierIDs}
+	}
+	if t.Title == "" {
+		t.Title = "Pedido recurrente en " + e.Name
+	}
+	return nil
+}
+
+func writeTemplateError(w http.ResponseWriter, err error) {
+	switch err {
+	case errTemplateSchedule, errInvalidTip, errTemplateItemRequired:
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeEstablishmentError(w, err)
+	}
+}
+
+func (h *OrderHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("user_id").(int)
+	rows, err := h.DB.Query("SELECT "+templateColumns+" FROM order_templates WHERE user_id = ? ORDER BY id", userId)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.OrderTemplate{}
+	for rows.Next() {
+		var t models.OrderTemplate
+		if err := scanTemplate(rows, &t); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		templates = append(templates, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// CreateTemplate crea una plantilla recurrente. Con fromOrderId se copian
+// establecimiento, productos y destino de una orden anterior del cliente.
+func (h *OrderHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		models.OrderTemplate
+		FromOrderID *int `json:"fromOrderId"`
+	}{OrderTemplate: models.OrderTemplate{Active: true}}
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+	t := body.OrderTemplate
+	t.UserID, _ = r.Context().Value("user_id").(int)
+
+	if body.FromOrderID != nil {
+		previous, status, err := loadOwnOrder(h.DB, *body.FromOrderID, t.UserID)
+		if err != nil {
+			apierror.Status(w, err, status)
+			return
+		}
+		t.EstablishmentID = *previous.EstablishmentID
+		t.Items = previous.Items
+		if t.DeliveryLocation == nil {
+			t.DeliveryLocation = previous.DeliveryLocation
+		}
+	}
+	if err := validateTemplate(h.DB, &t, time.Now()); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	result, err := h.DB.Exec(
+		`INSERT INTO order_templates (establishment_id, title, items, delivery_lat, delivery_lng,
+			tip, days, run_time, active, next_run_at, user_id)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		append(templateArgs(&t), t.UserID)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	err = scanTemplate(h.DB.QueryRow("SELECT "+templateColumns+" FROM order_templates WHERE id = ?", id), &t)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+func (h *OrderHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+	userId, _ := r.Context().Value("user_id").(int)
+
+	t := models.OrderTemplate{Active: true}
+	if !decodeRequest(w, r, &t) {
+		return
+	}
+	if err := validateTemplate(h.DB, &t, time.Now()); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	result, err := h.DB.Exec(
+		`UPDATE order_templates SET establishment_id = ?, title = ?, items = ?, delivery_lat = ?,
+			delivery_lng = ?, tip = ?, days = ?, run_time = ?, active = ?, next_run_at = ?
+		 WHERE id = ? AND user_id = ?`,
+		append(templateArgs(&t), id, userId)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Plantilla no encontrada", http.StatusNotFound)
+		return
+	}
+
+	err = scanTemplate(h.DB.QueryRow("SELECT "+templateColumns+" FROM order_templates WHERE id = ?", id), &t)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+func (h *OrderHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+	userId, _ := r.Context().Value("user_id").(int)
+
+	result, err := h.DB.Exec("DELETE FROM order_templates WHERE id = ? AND user_id = ?", id, userId)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Plantilla no encontrada", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
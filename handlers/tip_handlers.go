@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deliveryService/apierror"
+	"deliveryService/ledger"
+	"deliveryService/models"
+	"deliveryService/money"
+	"deliveryService/payments"
+	"github.com/gorilla/mux"
+)
+
+// UpdateTip fija la propina de la orden del cliente autenticado. Antes de
+// la entrega se vuelve a autorizar el pago por el nuevo total; después, y
+// solo dentro de TipWindow, la propina únicamente puede aumentarse y la
+// diferencia se cobra como un pago adicional.
+func (h *OrderHandler) UpdateTip(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	var tipData struct {
+		Tip money.Amount `json:"tip" validate:"min=0"`
+	}
+	if !decodeRequest(w, r, &tipData) {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var order models.Order
+	err = scanOrder(tx.QueryRow(
+		"SELECT "+orderColumns+" FROM orders WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id,
+	), &order)
+	if err == sql.ErrNoRows {
+		apierror.Error(w, "Orden no encontrada", http.StatusNotFound)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	if userId, _ := r.Context().Value("user_id").(int); userId != order.UserID {
+		apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+		return
+	}
+	delta := tipData.Tip - order.Tip
+	delivered := order.Status == "delivered"
+	switch {
+	case order.Status == "cancelled":
+		apierror.Error(w, "No se puede dar propina en una orden cancelada", http.StatusConflict)
+		return
+	case delivered && (order.DeliveredAt == nil || time.Since(*order.DeliveredAt) > h.TipWindow):
+		apierror.Error(w, "El plazo para dar propina ya terminó", http.StatusConflict)
+		return
+	case delivered && delta < 0:
+		apierror.Error(w, "Tras la entrega la propina solo puede aumentarse", http.StatusConflict)
+		return
+	case delta == 0:
+		w.Header().Set("Content-Type", "application/json")
+		setETag(w, order.Version)
+		json.NewEncoder(w).Encode(order)
+		return
+	}
+
+	// Si la transacción no llega a confirmarse se deshace lo hecho en la
+	// pasarela, para no cobrar una propina que no quedó registrada
+	newPrice := order.Price + delta
+	var change paymentChange
+	committed := false
+	defer func() {
+		if !committed {
+			change.undo(h.Payments, order.ID)
+		}
+	}()
+	if delivered {
+		change, err = h.chargeTip(tx, &order, delta)
+	} else {
+		change, err = h.reauthorizePayment(tx, &order, newPrice)
+	}
+	if err == payments.ErrDeclined || err == payments.ErrInvalidAmount {
+		apierror.Error(w, "Error al cobrar la propina: "+err.Error(), http.StatusPaymentRequired)
+		return
+	} else if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	_, err = tx.Exec(
+		"UPDATE orders SET tip = ?, price = ?, version = version + 1, updated_at = ? WHERE id = ?",
+		tipData.Tip, newPrice, time.Now(), id,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	err = scanOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ?", id), &order)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	committed = true
+	change.release(h.Payments, order.ID)
+
+	h.SSEManager.NotifyOrderUpdate(&order)
+	if order.DeliveryID != nil && delta > 0 {
+		h.SSEManager.NotifyUser(*order.DeliveryID, "tip_added", map[string]interface{}{
+			"orderId": order.ID,
+			"tip":     order.Tip,
+			"added":   delta,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, order.Version)
+	json.NewEncoder(w).Encode(order)
+}
+
+// paymentChange es lo hecho en la pasarela al cambiar la propina, para
+// deshacerlo si la transacción falla o completarlo cuando se confirma.
+type paymentChange struct {
+	ref      string       // autorización nueva
+	captured money.Amount // importe ya cobrado sobre ref
+	oldRef   string       // autorización sustituida, que se anula al confirmar
+}
+
+// undo anula la autorización nueva o, si ya se cobró, la reembolsa.
+func (c paymentChange) undo(provider payments.Provider, orderId int) {
+	var err error
+	switch {
+	case c.captured > 0:
+		_, err = provider.Refund(c.ref, c.captured)
+	case c.ref != "":
+		err = provider.Void(c.ref)
+	}
+	if err != nil {
+		log.Printf("Error deshaciendo el pago %s de la orden %d: %v", c.ref, orderId, err)
+	}
+}
+
+// release anula la autorización sustituida una vez confirmada la nueva.
+func (c paymentChange) release(provider payments.Provider, orderId int) {
+	if c.oldRef == "" {
+		return
+	}
+	if err := provider.Void(c.oldRef); err != nil {
+		log.Printf("Error anulando la autorización %s de la orden %d: %v", c.oldRef, orderId, err)
+	}
+}
+
+// reauthorizePayment sustituye la autorización vigente por una del nuevo
+// total. La anterior solo se anula cuando el llamador confirma la
+// transacción (ver paymentChange.release).
+func (h *OrderHandler) reauthorizePayment(tx *sql.Tx, order *models.Order, amount money.Amount) (paymentChange, error) {
+	var paymentId int
+	var oldRef string
+	err := tx.QueryRow(
+		"SELECT id, provider_reference FROM payments WHERE order_id = ? AND status = 'authorized' ORDER BY id DESC LIMIT 1 FOR UPDATE",
+		order.ID,
+	).Scan(&paymentId, &oldRef)
+	if err == sql.ErrNoRows {
+		ref, err := authorizePayment(tx, h.Payments, &models.Order{ID: order.ID, Price: amount})
+		return paymentChange{ref: ref}, err
+	} else if err != nil {
+		return paymentChange{}, err
+	}
+
+	ref, err := h.Payments.Authorize(amount, "order-"+strconv.Itoa(order.ID))
+	if err != nil {
+		return paymentChange{}, err
+	}
+	change := paymentChange{ref: ref, oldRef: oldRef}
+	_, err = tx.Exec(
+		"UPDATE payments SET provider_reference = ?, amount = ? WHERE id = ?",
+		ref, amount, paymentId,
+	)
+	return change, err
+}
+
+// chargeTip cobra el aumento de propina de una orden entregada y lo abona
+// al repartidor como una ganancia propia. Si la transacción no se confirma,
+// el llamador reembolsa el cobro con paymentChange.undo.
+func (h *OrderHandler) chargeTip(tx *sql.Tx, order *models.Order, delta money.Amount) (paymentChange, error) {
+	ref, err := h.Payments.Authorize(delta, "order-"+strconv.Itoa(order.ID)+"-tip")
+	if err != nil {
+		return paymentChange{}, err
+	}
+	if err := h.Payments.Capture(ref, delta); err != nil {
+		return paymentChange{ref: ref}, err
+	}
+	change := paymentChange{ref: ref, captured: delta}
+	result, err := tx.Exec(
+		`INSERT INTO payments (order_id, provider, provider_reference, amount, captured_amount, status)
+		 VALUES (?, ?, ?, ?, ?, 'captured')`,
+		order.ID, h.Payments.Name(), ref, delta, delta,
+	)
+	if err != nil {
+		return change, err
+	}
+	paymentId, _ := result.LastInsertId()
+
+	if order.DeliveryID == nil {
+		return change, nil
+	}
+	// recordCourierEarning solo corre al entregarse la orden, así que el
+	// aumento se registra aquí como una ganancia aparte. No modifica la de la
+	// entrega, que puede estar ya liquidada: entra en la siguiente liquidación
+	_, err = tx.Exec(
+		`INSERT INTO courier_earnings (order_id, courier_id, tip_payment_id, base_fee, distance_fee, distance_km, tip, total)
+		 VALUES (?, ?, ?, 0, 0, 0, ?, ?)`,
+		order.ID, *order.DeliveryID, paymentId, delta, delta,
+	)
+	if err != nil {
+		return change, err
+	}
+	return change, ledger.Post(tx, "courier_tip", "order:"+strconv.Itoa(order.ID),
+		ledger.Entry{Account: ledger.Tips, Debit: delta},
+		ledger.Entry{Account: ledger.CourierAccount(*order.DeliveryID), Credit: delta},
+	)
+}
@@ -5,42 +5,57 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
+	"deliveryService/apierror"
+	"deliveryService/geocoding"
 	"deliveryService/models"
 	"github.com/gorilla/mux"
 )
 
 type UserHandler struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Geocoder geocoding.Geocoder
 }
 
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	err := json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req models.RegisterRequest
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
-	// Validar rol
-	if user.Role != "customer" && user.Role != "delivery" {
-		http.Error(w, "Rol inválido. Debe ser 'customer' o 'delivery'", http.StatusBadRequest)
-		return
+	if req.AddressDetails != nil {
+		if err := resolveAddress(h.Geocoder, req.AddressDetails); err != nil {
+			apierror.Error(w, err.Error(), addressStatus(err))
+			return
+		}
+		if req.Address == nil {
+			formatted := req.AddressDetails.String()
+			req.Address = &formatted
+		}
 	}
 
 	// En producción, hashear el password
 	result, err := h.DB.Exec(
-		"INSERT INTO users (name, password, role, address) VALUES (?, ?, ?, ?)",
-		user.Name, user.Password, user.Role, user.Address,
+		`INSERT INTO users (name, password, role, address, address_street, address_city,
+			address_postal_code, address_notes, address_lat, address_lng)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		append([]interface{}{req.Name, req.Password, req.Role, req.Address},
+			addressArgs(req.AddressDetails)...)...,
 	)
 	if err != nil {
-		http.Error(w, "Error al crear usuario: "+err.Error(), http.StatusInternalServerError)
+		apierror.Internal(w, err)
 		return
 	}
 
 	id, _ := result.LastInsertId()
-	user.ID = int(id)
-	user.Password = "" // No enviar password en respuesta
+	user := models.User{
+		ID:             int(id),
+		Name:           req.Name,
+		Role:           req.Role,
+		Address:        req.Address,
+		AddressDetails: req.AddressDetails,
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -51,24 +66,32 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "ID inválido", http.StatusBadRequest)
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
 		return
 	}
 
 	var user models.User
-	err = h.DB.QueryRow(
-		"SELECT id, name, role, address FROM users WHERE id = ?",
+	err = scanUser(h.DB.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = ? AND deleted_at IS NULL",
 		id,
-	).Scan(&user.ID, &user.Name, &user.Role, &user.Address)
+	), &user)
 
 	if err == sql.ErrNoRows {
-		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		apierror.Error(w, "Usuario no encontrado", http.StatusNotFound)
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Internal(w, err)
 		return
 	}
 
+	if user.Role == "delivery" {
+		user.Rating, err = loadRating(h.DB, "courier", user.ID)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
@@ -77,28 +100,51 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "ID inválido", http.StatusBadRequest)
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
 		return
 	}
 
-	var user models.User
-	err = json.NewDecoder(r.Body).Decode(&user)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req models.UpdateUserRequest
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
-	_, err = h.DB.Exec(
-		"UPDATE users SET name = ?, address = ? WHERE id = ?",
-		user.Name, user.Address, id,
+	if req.AddressDetails != nil {
+		if err := resolveAddress(h.Geocoder, req.AddressDetails); err != nil {
+			apierror.Error(w, err.Error(), addressStatus(err))
+			return
+		}
+		if req.Address == nil {
+			formatted := req.AddressDetails.String()
+			req.Address = &formatted
+		}
+	}
+
+	result, err := h.DB.Exec(
+		`UPDATE users SET name = ?, address = ?, address_street = ?, address_city = ?,
+			address_postal_code = ?, address_notes = ?, address_lat = ?, address_lng = ?
+		 WHERE id = ? AND deleted_at IS NULL`,
+		append(append([]interface{}{req.Name, req.Address}, addressArgs(req.AddressDetails)...), id)...,
 	)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return
+	}
+
+	var user models.User
+	err = scanUser(h.DB.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = ? AND deleted_at IS NULL",
+		id,
+	), &user)
+	if err != nil {
+		apierror.Internal(w, err)
 		return
 	}
 
-	user.ID = id
-	user.Password = ""
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
@@ -107,38 +153,127 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "ID inválido", http.StatusBadRequest)
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
 		return
 	}
 
-	_, err = h.DB.Exec("DELETE FROM users WHERE id = ?", id)
+	// Borrado lógico: las órdenes del usuario se conservan hasta la purga
+	result, err := h.DB.Exec(
+		"UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+		time.Now(), id,
+	)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Usuario no encontrado", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.DB.Exec(
+		"UPDATE users SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL",
+		id,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Usuario eliminado no encontrado", http.StatusNotFound)
+		return
+	}
+
+	var user models.User
+	err = scanUser(h.DB.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id), &user)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+var userSortFields = map[string]sortField{
+	"createdAt": {column: "created_at", parse: parseTimeValue},
+	"name":      {column: "name", parse: parseStringValue},
+}
+
 func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.Query("SELECT id, name, role, address FROM users")
+	query := r.URL.Query()
+	page, err := parsePageParams(query, userSortFields)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filters := &listQuery{}
+	filters.add("deleted_at IS NULL")
+	if v := query.Get("role"); v != "" {
+		filters.add("role = ?", v)
+	}
+	if v := query.Get("name"); v != "" {
+		filters.add("name LIKE ?", "%"+v+"%")
+	}
+
+	var total int
+	err = h.DB.QueryRow("SELECT COUNT(*) FROM users"+filters.where(), filters.args...).Scan(&total)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	orderBy, err := page.apply(filters)
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT "+userColumns+", created_at FROM users"+filters.where()+orderBy, filters.args...)
+	if err != nil {
+		apierror.Internal(w, err)
 		return
 	}
 	defer rows.Close()
 
-	var users []models.User
+	users := []models.User{}
+	var createdAt []time.Time
 	for rows.Next() {
 		var user models.User
-		err := rows.Scan(&user.ID, &user.Name, &user.Role, &user.Address)
+		var created time.Time
+		err := scanUser(rows, &user, &created)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierror.Internal(w, err)
 			return
 		}
 		users = append(users, user)
+		createdAt = append(createdAt, created)
 	}
 
+	response := Page{Total: total}
+	if len(users) > page.limit {
+		users = users[:page.limit]
+		last := users[len(users)-1]
+		value := createdAt[len(users)-1].Format(time.RFC3339Nano)
+		if page.sort == "name" {
+			value = last.Name
+		}
+		response.NextCursor = page.nextCursor(value, last.ID)
+	}
+	response.Data = users
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
-}
\ No newline at end of file
+	json.NewEncoder(w).Encode(response)
+}
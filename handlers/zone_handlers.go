@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"deliveryService/apierror"
+	"deliveryService/models"
+	"deliveryService/zones"
+	"github.com/gorilla/mux"
+)
+
+type ZoneHandler struct {
+	DB *sql.DB
+}
+
+func validateZone(zone *models.Zone) error {
+	if zone.Name == "" {
+		return errors.New("El nombre de la zona es requerido")
+	}
+	switch zone.Kind {
+	case "polygon":
+		if len(zone.Polygon) < 3 {
+			return errors.New("Un polígono requiere al menos 3 vértices")
+		}
+		zone.Center, zone.RadiusKm = nil, 0
+	case "radius":
+		if zone.Center == nil || zone.RadiusKm <= 0 {
+			return errors.New("Una zona circular requiere centro y radio positivo")
+		}
+		zone.Polygon = nil
+	default:
+		return errors.New("Tipo de zona inválido. Debe ser 'polygon' o 'radius'")
+	}
+	if zone.DeliveryFee != nil && *zone.DeliveryFee < 0 {
+		return errors.New("La tarifa de envío de la zona no puede ser negativa")
+	}
+	return nil
+}
+
+func zoneArgs(zone *models.Zone) []interface{} {
+	var polygon interface{}
+	if zone.Polygon != nil {
+		raw, _ := json.Marshal(zone.Polygon)
+		polygon = string(raw)
+	}
+	var radius interface{}
+	if zone.RadiusKm > 0 {
+		radius = zone.RadiusKm
+	}
+	lat, lng := pointArgs(zone.Center)
+	return []interface{}{zone.Name, zone.Kind, polygon, lat, lng, radius, zone.Active, zone.DeliveryFee}
+}
+
+func (h *ZoneHandler) GetZones(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query("SELECT " + zones.Columns + " FROM delivery_zones ORDER BY id")
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	defer rows.Close()
+
+	result := []models.Zone{}
+	for rows.Next() {
+		var zone models.Zone
+		if err := zones.Scan(rows, &zone); err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		result = append(result, zone)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *ZoneHandler) CreateZone(w http.ResponseWriter, r *http.Request) {
+	zone := models.Zone{Active: true}
+	if !decodeRequest(w, r, &zone) {
+		return
+	}
+	if err := validateZone(&zone); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.DB.Exec(
+		`INSERT INTO delivery_zones (name, kind, polygon, center_lat, center_lng, radius_km, active, delivery_fee)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		zoneArgs(&zone)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	zone.ID = int(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(zone)
+}
+
+func (h *ZoneHandler) UpdateZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	zone := models.Zone{Active: true}
+	if !decodeRequest(w, r, &zone) {
+		return
+	}
+	if err := validateZone(&zone); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.DB.Exec(
+		`UPDATE delivery_zones SET name = ?, kind = ?, polygon = ?, center_lat = ?, center_lng = ?,
+			radius_km = ?, active = ?, delivery_fee = ?
+		 WHERE id = ?`,
+		append(zoneArgs(&zone), id)...,
+	)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Zona no encontrada", http.StatusNotFound)
+		return
+	}
+
+	zone.ID = id
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(zone)
+}
+
+func (h *ZoneHandler) DeleteZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		apierror.Error(w, "ID inválido", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.DB.Exec("DELETE FROM delivery_zones WHERE id = ?", id)
+	if err != nil {
+		apierror.Internal(w, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		apierror.Error(w, "Zona no encontrada", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
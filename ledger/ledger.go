@@ -0,0 +1,72 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"deliveryService/money"
+)
+
+// Cuentas de la plataforma. Cada repartidor tiene además su cuenta por
+// pagar (ver CourierAccount).
+const (
+	DeliveryExpense = "platform:delivery_expense"
+	Cash            = "platform:cash"
+	Tips            = "platform:tips" // propinas cobradas que se transfieren al repartidor
+)
+
+var ErrUnbalanced = errors.New("ledger: los cargos y abonos del asiento no cuadran")
+
+// Entry es una línea de un asiento: un cargo (Debit) o un abono (Credit).
+type Entry struct {
+	Account string
+	Debit   money.Amount
+	Credit  money.Amount
+}
+
+// CourierAccount es la cuenta por pagar al repartidor. Su saldo (abonos
+// menos cargos) es lo que se le debe.
+func CourierAccount(courierId int) string {
+	return "courier:" + strconv.Itoa(courierId) + ":payable"
+}
+
+// Post registra un asiento de partida doble dentro de tx. Rechaza asientos
+// cuyos cargos y abonos no sumen lo mismo.
+func Post(tx *sql.Tx, kind string, reference string, entries ...Entry) error {
+	var debits, credits money.Amount
+	for _, e := range entries {
+		debits += e.Debit
+		credits += e.Credit
+	}
+	if len(entries) < 2 || debits != credits {
+		return ErrUnbalanced
+	}
+
+	result, err := tx.Exec("INSERT INTO ledger_transactions (kind, reference) VALUES (?, ?)", kind, reference)
+	if err != nil {
+		return err
+	}
+	txId, _ := result.LastInsertId()
+
+	for _, e := range entries {
+		_, err := tx.Exec(
+			"INSERT INTO ledger_entries (transaction_id, account, debit, credit) VALUES (?, ?, ?, ?)",
+			txId, e.Account, e.Debit, e.Credit,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Balance devuelve abonos menos cargos de la cuenta.
+func Balance(db *sql.DB, account string) (money.Amount, error) {
+	var balance money.Amount
+	err := db.QueryRow(
+		"SELECT COALESCE(SUM(credit) - SUM(debit), 0) FROM ledger_entries WHERE account = ?",
+		account,
+	).Scan(&balance)
+	return balance, err
+}
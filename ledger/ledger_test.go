@@ -0,0 +1,29 @@
+package ledger
+
+import "testing"
+
+// Los asientos descuadrados se rechazan antes de tocar la base de datos, por
+// lo que basta con una transacción nula.
+func TestPostUnbalanced(t *testing.T) {
+	courier := CourierAccount(7)
+	tests := []struct {
+		name    string
+		entries []Entry
+	}{
+		{"sin líneas", nil},
+		{"una sola línea", []Entry{{Account: Cash, Debit: 0, Credit: 0}}},
+		{"cargos mayores", []Entry{{Account: DeliveryExpense, Debit: 5000}, {Account: courier, Credit: 4999}}},
+		{"abonos mayores", []Entry{{Account: Tips, Debit: 1000}, {Account: courier, Credit: 600}, {Account: Cash, Credit: 600}}},
+	}
+	for _, tt := range tests {
+		if err := Post(nil, "test", "ref", tt.entries...); err != ErrUnbalanced {
+			t.Errorf("%s: Post error = %v, want ErrUnbalanced", tt.name, err)
+		}
+	}
+}
+
+func TestCourierAccount(t *testing.T) {
+	if got := CourierAccount(42); got != "courier:42:payable" {
+		t.Errorf("CourierAccount(42) = %q", got)
+	}
+}
@@ -4,10 +4,22 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
+	"deliveryService/apierror"
+	"deliveryService/dispatch"
+	"deliveryService/earnings"
+	"deliveryService/eta"
+	"deliveryService/geocoding"
 	"deliveryService/handlers"
+	"deliveryService/middleware"
 	"deliveryService/models"
+	"deliveryService/money"
+	"deliveryService/payments"
+	"deliveryService/pricing"
+	"deliveryService/retention"
 	"deliveryService/sse"
 
 	"github.com/gorilla/mux"
@@ -19,7 +31,7 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Println("=== INICIANDO DELIVERY SERVICE CON MYSQL ===")
 
-	dsn := "adri:1234@tcp(100.30.88.139:3306)/DeliveryService?charset=utf8mb4&parseTime=True&loc=Local"
+	dsn := "adri:1234@tcp(100.30.88.139:3306)/DeliveryService?charset=utf8mb4&parseTime=True&loc=Local&clientFoundRows=true"
 	
 	// Primera conexión (sin base de datos específica para crearla si no existe)
 	db, err := sql.Open("mysql", dsn)
@@ -60,15 +72,107 @@ func main() {
 	log.Println("Inicializando SSE Manager...")
 	sseManager := sse.NewSSEManager()
 
+	retentionDays := getEnvInt("RETENTION_DAYS", 90)
+	log.Printf("Iniciando purga de registros eliminados (retención: %d días)...", retentionDays)
+	purger := &retention.Purger{
+		DB:        db,
+		Retention: time.Duration(retentionDays) * 24 * time.Hour,
+		Interval:  time.Hour,
+	}
+	purger.Start()
+
+	strategyName := os.Getenv("DISPATCH_STRATEGY")
+	if strategyName == "" {
+		strategyName = "least_loaded"
+	}
+	dispatcher := dispatch.NewEngine(db, sseManager, nil,
+		time.Duration(getEnvPositiveInt("DISPATCH_INTERVAL_SECONDS", 10))*time.Second,
+		time.Duration(getEnvInt("DISPATCH_OFFER_TIMEOUT_SECONDS", 30))*time.Second,
+	)
+	if strategy, ok := dispatch.NewStrategy(strategyName); ok {
+		log.Printf("Iniciando motor de despacho (estrategia: %s)...", strategyName)
+		dispatcher.Strategy = strategy
+		dispatcher.Start()
+	} else {
+		log.Printf("⚠️ Despacho automático desactivado (estrategia: %q)", strategyName)
+	}
+
+	presenceWatcher := &dispatch.PresenceWatcher{
+		DB:         db,
+		SSEManager: sseManager,
+		Grace:      time.Duration(getEnvPositiveInt("COURIER_OFFLINE_GRACE_SECONDS", 120)) * time.Second,
+	}
+	presenceWatcher.Start()
+
+	etaConfig := eta.Config{
+		SpeedKmh:   float64(getEnvInt("ETA_SPEED_KMH", 25)),
+		PrepTime:   time.Duration(getEnvInt("ETA_PREP_MINUTES", 15)) * time.Minute,
+		DefaultLeg: time.Duration(getEnvInt("ETA_DEFAULT_LEG_MINUTES", 20)) * time.Minute,
+	}
+
+	// Importes en centavos y tasas en puntos básicos (1600 = 16%)
+	pricingConfig := pricing.Config{
+		BaseDeliveryFee: money.Amount(getEnvInt("PRICING_BASE_DELIVERY_FEE_CENTS", 2500)),
+		PerKmFee:        money.Amount(getEnvInt("PRICING_PER_KM_FEE_CENTS", 800)),
+		ServiceFeeBps:   int64(getEnvInt("PRICING_SERVICE_FEE_BPS", 500)),
+		TaxBps:          int64(getEnvInt("PRICING_TAX_BPS", 1600)),
+		SurgeRatio:      float64(getEnvInt("PRICING_SURGE_RATIO", 3)),
+		MaxSurgeBps:     int64(getEnvInt("PRICING_MAX_SURGE_BPS", 20000)),
+	}
+
+	earningsConfig := earnings.Config{
+		BaseFee:  money.Amount(getEnvInt("COURIER_BASE_FEE_CENTS", 2000)),
+		PerKmFee: money.Amount(getEnvInt("COURIER_PER_KM_FEE_CENTS", 500)),
+	}
+
+	tipWindow := time.Duration(getEnvInt("TIP_WINDOW_HOURS", 24)) * time.Hour
+
+	paymentProvider := &payments.FakeProvider{
+		DeclineAbove: money.Amount(getEnvInt("FAKE_PAYMENT_DECLINE_ABOVE_CENTS", 0)),
+	}
+
+	geocoder := &geocoding.StaticGeocoder{}
+	if path := os.Getenv("GEOCODER_TABLE"); path != "" {
+		geocoder, err = geocoding.LoadStaticGeocoder(path)
+		if err != nil {
+			log.Fatal("Error cargando tabla de geocodificación:", err)
+		}
+		log.Printf("✅ Tabla de geocodificación cargada: %s", path)
+	}
+
 	// Inicializar handlers
 	log.Println("Inicializando handlers...")
-	userHandler := &handlers.UserHandler{DB: db}
-	orderHandler := &handlers.OrderHandler{DB: db, SSEManager: sseManager}
-	loginHandler := &handlers.LoginHandler{DB: db}
+	userHandler := &handlers.UserHandler{DB: db, Geocoder: geocoder}
+	orderHandler := &handlers.OrderHandler{DB: db, SSEManager: sseManager, Dispatcher: dispatcher, ETA: etaConfig, Pricing: pricingConfig, Payments: paymentProvider, Earnings: earningsConfig, TipWindow: tipWindow,
+		ScheduleLead:    time.Duration(getEnvInt("SCHEDULE_LEAD_MINUTES", 45)) * time.Minute,
+		ScheduleHorizon: time.Duration(getEnvInt("SCHEDULE_HORIZON_DAYS", 7)) * 24 * time.Hour,
+	}
+	loginHandler := &handlers.LoginHandler{DB: db, Geocoder: geocoder}
+	zoneHandler := &handlers.ZoneHandler{DB: db}
+	establishmentHandler := &handlers.EstablishmentHandler{DB: db, Geocoder: geocoder}
+	promotionHandler := &handlers.PromotionHandler{DB: db}
+	reviewHandler := &handlers.ReviewHandler{DB: db}
+	batchHandler := &handlers.BatchHandler{DB: db, SSEManager: sseManager, ETA: etaConfig, Payments: paymentProvider, Earnings: earningsConfig}
+	deliveryHandler := &handlers.DeliveryHandler{DB: db, SSEManager: sseManager, ETA: etaConfig}
+	authMiddleware := &middleware.AuthMiddleware{DB: db}
+	idempotency := &middleware.IdempotencyMiddleware{
+		DB:  db,
+		TTL: time.Duration(getEnvInt("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour,
+	}
+
+	log.Println("Iniciando planificador de órdenes programadas...")
+	scheduler := &handlers.OrderScheduler{
+		Orders:          orderHandler,
+		Interval:        time.Duration(getEnvInt("SCHEDULER_INTERVAL_SECONDS", 30)) * time.Second,
+		TemplateAdvance: time.Duration(getEnvInt("TEMPLATE_ADVANCE_MINUTES", 120)) * time.Minute,
+	}
+	scheduler.Start()
 
 	// Configurar router
 	log.Println("Configurando rutas...")
 	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(apierror.NotFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(apierror.MethodNotAllowed)
 
 	// Middleware para logging
 	r.Use(func(next http.Handler) http.Handler {
@@ -83,7 +187,8 @@ func main() {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, Idempotency-Key, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed, X-Request-ID")
 			
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -115,13 +220,62 @@ func main() {
 	api.HandleFunc("/users/{id}", userHandler.DeleteUser).Methods("DELETE", "OPTIONS")
 
 	// Order routes
-	api.HandleFunc("/orders", orderHandler.CreateOrder).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders", authMiddleware.Authenticate(idempotency.Handle(orderHandler.CreateOrder))).Methods("POST", "OPTIONS")
 	api.HandleFunc("/orders", orderHandler.GetAllOrders).Methods("GET", "OPTIONS")
+	api.HandleFunc("/orders/quote", orderHandler.QuoteOrder).Methods("POST", "OPTIONS")
 	api.HandleFunc("/orders/user/{userId}", orderHandler.GetUserOrders).Methods("GET", "OPTIONS")
 	api.HandleFunc("/orders/{id}", orderHandler.GetOrder).Methods("GET", "OPTIONS")
-	api.HandleFunc("/orders/{id}/status", orderHandler.UpdateOrderStatus).Methods("PATCH", "OPTIONS")
-	api.HandleFunc("/orders/{id}/assign", orderHandler.AssignDelivery).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id}/trail", authMiddleware.Authenticate(orderHandler.GetOrderTrail, "customer", "delivery", "admin")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/orders/{id}/status", authMiddleware.Authenticate(idempotency.Handle(orderHandler.UpdateOrderStatus))).Methods("PATCH", "OPTIONS")
+	api.HandleFunc("/orders/{id}/assign", authMiddleware.Authenticate(idempotency.Handle(orderHandler.AssignDelivery))).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id}/claim", authMiddleware.Authenticate(orderHandler.ClaimOrder, "delivery")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id}/offer/accept", authMiddleware.Authenticate(orderHandler.AcceptOffer, "delivery")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id}/offer/decline", authMiddleware.Authenticate(orderHandler.DeclineOffer, "delivery")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id}/reorder", authMiddleware.Authenticate(idempotency.Handle(orderHandler.Reorder), "customer")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id}/tip", authMiddleware.Authenticate(idempotency.Handle(orderHandler.UpdateTip), "customer")).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/orders/{id}/review", authMiddleware.Authenticate(reviewHandler.CreateReview, "customer")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/orders/{id}/refunds", authMiddleware.Authenticate(orderHandler.GetRefunds, "admin")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/orders/{id}/refunds", authMiddleware.Authenticate(idempotency.Handle(orderHandler.CreateRefund), "admin")).Methods("POST", "OPTIONS")
 	api.HandleFunc("/orders/{id}", orderHandler.DeleteOrder).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/order-templates", authMiddleware.Authenticate(orderHandler.GetTemplates, "customer")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/order-templates", authMiddleware.Authenticate(orderHandler.CreateTemplate, "customer")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/order-templates/{id}", authMiddleware.Authenticate(orderHandler.UpdateTemplate, "customer")).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/order-templates/{id}", authMiddleware.Authenticate(orderHandler.DeleteTemplate, "customer")).Methods("DELETE", "OPTIONS")
+
+	// Establishment routes
+	api.HandleFunc("/establishments", establishmentHandler.GetEstablishments).Methods("GET", "OPTIONS")
+	api.HandleFunc("/establishments", authMiddleware.Authenticate(establishmentHandler.CreateEstablishment, "establishment", "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/establishments/{id}", establishmentHandler.GetEstablishment).Methods("GET", "OPTIONS")
+	api.HandleFunc("/establishments/{id}", authMiddleware.Authenticate(establishmentHandler.UpdateEstablishment, "establishment", "admin")).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/establishments/{id}/reviews", reviewHandler.GetEstablishmentReviews).Methods("GET", "OPTIONS")
+	api.HandleFunc("/establishments/{id}/menu", authMiddleware.Authenticate(establishmentHandler.CreateMenuItem, "establishment", "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/establishments/{id}/menu/{itemId}", authMiddleware.Authenticate(establishmentHandler.UpdateMenuItem, "establishment", "admin")).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/establishments/{id}/menu/{itemId}", authMiddleware.Authenticate(establishmentHandler.DeleteMenuItem, "establishment", "admin")).Methods("DELETE", "OPTIONS")
+
+	// Batch routes
+	api.HandleFunc("/batches", authMiddleware.Authenticate(batchHandler.CreateBatch, "delivery", "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/batches/{id}", authMiddleware.Authenticate(batchHandler.GetBatch, "delivery", "admin")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/batches/{id}/status", authMiddleware.Authenticate(idempotency.Handle(batchHandler.UpdateBatchStatus), "delivery", "admin")).Methods("PATCH", "OPTIONS")
+
+	// Delivery routes
+	api.HandleFunc("/deliveries/available", authMiddleware.Authenticate(deliveryHandler.GetAvailableOrders, "delivery")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/deliveries/status", authMiddleware.Authenticate(deliveryHandler.GetStatus, "delivery")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/deliveries/status", authMiddleware.Authenticate(deliveryHandler.UpdateStatus, "delivery")).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/deliveries/location", authMiddleware.Authenticate(deliveryHandler.UpdateLocation, "delivery")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/deliveries/earnings", authMiddleware.Authenticate(deliveryHandler.GetEarnings, "delivery")).Methods("GET", "OPTIONS")
+
+	// Admin routes
+	api.HandleFunc("/admin/users/{id}/restore", authMiddleware.Authenticate(userHandler.RestoreUser, "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/orders/{id}/restore", authMiddleware.Authenticate(orderHandler.RestoreOrder, "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/zones", authMiddleware.Authenticate(zoneHandler.GetZones, "admin")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/admin/zones", authMiddleware.Authenticate(zoneHandler.CreateZone, "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/zones/{id}", authMiddleware.Authenticate(zoneHandler.UpdateZone, "admin")).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/admin/zones/{id}", authMiddleware.Authenticate(zoneHandler.DeleteZone, "admin")).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/admin/reports/couriers", authMiddleware.Authenticate(reviewHandler.GetCourierReport, "admin")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/admin/payouts/weekly", authMiddleware.Authenticate(deliveryHandler.GenerateWeeklyPayouts, "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/promotions", authMiddleware.Authenticate(promotionHandler.GetPromotions, "admin")).Methods("GET", "OPTIONS")
+	api.HandleFunc("/admin/promotions", authMiddleware.Authenticate(promotionHandler.CreatePromotion, "admin")).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/promotions/{id}", authMiddleware.Authenticate(promotionHandler.UpdatePromotion, "admin")).Methods("PUT", "OPTIONS")
 
 	// Iniciar servidor
 	port := ":8080"
@@ -133,10 +287,55 @@ func main() {
 	log.Println("   - GET   /health")
 	log.Println("   - GET   /api/users")
 	log.Println("   - POST  /api/orders")
+	log.Println("   - POST  /api/orders/quote")
 	log.Println("   - GET   /api/orders/user/{userId}")
 	log.Println("   - PATCH /api/orders/{id}/status")
 	log.Println("   - POST  /api/orders/{id}/assign")
+	log.Println("   - POST  /api/orders/{id}/claim")
+	log.Println("   - POST  /api/orders/{id}/offer/accept")
+	log.Println("   - POST  /api/orders/{id}/offer/decline")
+	log.Println("   - PUT   /api/orders/{id}/tip")
+	log.Println("   - POST  /api/orders/{id}/reorder")
+	log.Println("   - POST  /api/order-templates")
+	log.Println("   - POST  /api/orders/{id}/refunds")
+	log.Println("   - POST  /api/orders/{id}/review")
+	log.Println("   - GET   /api/establishments")
+	log.Println("   - POST  /api/establishments/{id}/menu")
+	log.Println("   - POST  /api/batches")
+	log.Println("   - PATCH /api/batches/{id}/status")
+	log.Println("   - GET   /api/deliveries/available")
+	log.Println("   - PUT   /api/deliveries/status")
+	log.Println("   - POST  /api/deliveries/location")
+	log.Println("   - GET   /api/deliveries/earnings")
+	log.Println("   - POST  /api/admin/users/{id}/restore")
+	log.Println("   - POST  /api/admin/orders/{id}/restore")
+	log.Println("   - GET   /api/admin/zones")
+	log.Println("   - POST  /api/admin/promotions")
+	log.Println("   - POST  /api/admin/payouts/weekly")
+	log.Println("   - GET   /api/admin/reports/couriers")
 	log.Println("Presiona Ctrl+C para detener el servidor")
 	
-	log.Fatal(http.ListenAndServe(port, r))
-}
\ No newline at end of file
+	// El identificador de petición envuelve al router para cubrir también
+	// las rutas inexistentes
+	log.Fatal(http.ListenAndServe(port, apierror.RequestID(r)))
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvPositiveInt es getEnvInt para los valores que no pueden ser cero ni
+// negativos, como los intervalos de los tickers: un valor inválido se
+// ignora en favor de fallback.
+func getEnvPositiveInt(key string, fallback int) int {
+	value := getEnvInt(key, fallback)
+	if value <= 0 {
+		log.Printf("⚠️ %s debe ser mayor que 0, se usa %d", key, fallback)
+		return fallback
+	}
+	return value
+}
@@ -2,42 +2,65 @@ package middleware
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"deliveryService/apierror"
 )
 
 type AuthMiddleware struct {
-	// Aquí podrías tener una instancia de tu manejador de usuarios
+	DB *sql.DB
 }
 
 func (m *AuthMiddleware) ValidateToken(token string) (int, string, error) {
 	// Formato: "user_id:role"
 	parts := strings.Split(token, ":")
-	if len(parts) == 2 {
-		return 1, parts[1], nil
+	if len(parts) != 2 {
+		return 0, "", errors.New("formato de token inválido")
 	}
-	return 0, "", nil
+
+	userId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", err
+	}
+
+	// El rol se toma de la BD; usuarios eliminados no pueden autenticarse
+	var role string
+	err = m.DB.QueryRow(
+		"SELECT role FROM users WHERE id = ? AND deleted_at IS NULL",
+		userId,
+	).Scan(&role)
+	if err != nil {
+		return 0, "", err
+	}
+	if role != parts[1] {
+		return 0, "", errors.New("rol no coincide")
+	}
+
+	return userId, role, nil
 }
 
 func (m *AuthMiddleware) Authenticate(next http.HandlerFunc, allowedRoles ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("Authorization")
 		if token == "" {
-			http.Error(w, "Token no proporcionado", http.StatusUnauthorized)
+			apierror.Error(w, "Token no proporcionado", http.StatusUnauthorized)
 			return
 		}
 
-		
+
 		token = strings.TrimPrefix(token, "Bearer ")
 
 		userId, role, err := m.ValidateToken(token)
 		if err != nil || userId == 0 {
-			http.Error(w, "Token inválido", http.StatusUnauthorized)
+			apierror.Error(w, "Token inválido", http.StatusUnauthorized)
 			return
 		}
 
-		
+
 		if len(allowedRoles) > 0 {
 			roleAllowed := false
 			for _, allowedRole := range allowedRoles {
@@ -47,12 +70,12 @@ func (m *AuthMiddleware) Authenticate(next http.HandlerFunc, allowedRoles ...str
 				}
 			}
 			if !roleAllowed {
-				http.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
+				apierror.Error(w, "No tiene permisos para acceder", http.StatusForbidden)
 				return
 			}
 		}
 
-		
+
 		ctx := context.WithValue(r.Context(), "user_id", userId)
 		ctx = context.WithValue(ctx, "user_role", role)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"deliveryService/apierror"
+)
+
+// MaxIdempotencyBody limita el cuerpo que se lee para calcular la huella.
+const MaxIdempotencyBody = 1 << 20
+
+// replayedHeaders son las cabeceras de la respuesta original que se
+// conservan para repetirla.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// IdempotencyMiddleware guarda la respuesta de las peticiones que traen la
+// cabecera Idempotency-Key y la repite ante reintentos con la misma clave
+// durante TTL. La clave se asocia al usuario autenticado y a una huella de
+// método, ruta y cuerpo, por lo que debe montarse detrás de Authenticate.
+type IdempotencyMiddleware struct {
+	DB  *sql.DB
+	TTL time.Duration
+}
+
+type idempotencyRecord struct {
+	fingerprint string
+	status      sql.NullInt64
+	headers     sql.NullString
+	body        []byte
+	expiresAt   time.Time
+}
+
+func (m *IdempotencyMiddleware) Handle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			apierror.Error(w, "Idempotency-Key no puede superar 255 caracteres", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxIdempotencyBody+1))
+		if err != nil {
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > MaxIdempotencyBody {
+			apierror.Error(w, "Cuerpo de la petición demasiado grande", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Sin usuario todas las peticiones compartirían el mismo espacio de
+		// claves y podrían recibir la respuesta guardada de otro cliente
+		userId, _ := r.Context().Value("user_id").(int)
+		if userId == 0 {
+			apierror.Error(w, "Idempotency-Key requiere una petición autenticada", http.StatusUnauthorized)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "\n" + string(body)))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		acquired, record, err := m.acquire(userId, key, fingerprint)
+		if err != nil {
+			apierror.Internal(w, err)
+			return
+		}
+		if !acquired {
+			switch {
+			case record.fingerprint != fingerprint:
+				apierror.Error(w, "La Idempotency-Key ya se usó con otra petición", http.StatusUnprocessableEntity)
+			case !record.status.Valid:
+				apierror.Error(w, "Una petición con esta Idempotency-Key sigue en curso", http.StatusConflict)
+			default:
+				replay(w, record)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		m.store(userId, key, recorder)
+	}
+}
+
+// acquire reserva la clave insertando un registro sin respuesta. Si ya
+// existe uno vigente lo devuelve; uno caducado se descarta y se reintenta.
+func (m *IdempotencyMiddleware) acquire(userId int, key, fingerprint string) (bool, *idempotencyRecord, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		result, err := m.DB.Exec(
+			`INSERT IGNORE INTO idempotency_keys (user_id, idem_key, fingerprint, created_at, expires_at)
+			 VALUES (?, ?, ?, ?, ?)`,
+			userId, key, fingerprint, now, now.Add(m.TTL),
+		)
+		if err != nil {
+			return false, nil, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			return true, nil, nil
+		}
+
+		var record idempotencyRecord
+		err = m.DB.QueryRow(
+			`SELECT fingerprint, status_code, response_headers, response_body, expires_at
+			 FROM idempotency_keys WHERE user_id = ? AND idem_key = ?`,
+			userId, key,
+		).Scan(&record.fingerprint, &record.status, &record.headers, &record.body, &record.expiresAt)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return false, nil, err
+		}
+		if record.expiresAt.After(now) {
+			return false, &record, nil
+		}
+
+		_, err = m.DB.Exec(
+			"DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ? AND expires_at <= ?",
+			userId, key, now,
+		)
+		if err != nil {
+			return false, nil, err
+		}
+	}
+	return false, nil, sql.ErrNoRows
+}
+
+// store guarda la respuesta. Los errores del servidor liberan la clave para
+// que el cliente pueda reintentar, y también si no se pudo guardar: de lo
+// contrario la clave quedaría "en curso" hasta caducar.
+func (m *IdempotencyMiddleware) store(userId int, key string, recorder *responseRecorder) {
+	if recorder.status >= http.StatusInternalServerError {
+		m.release(userId, key)
+		return
+	}
+
+	headers := map[string]string{}
+	for _, name := range replayedHeaders {
+		if v := recorder.Header().Get(name); v != "" {
+			headers[name] = v
+		}
+	}
+	rawHeaders, _ := json.Marshal(headers)
+	_, err := m.DB.Exec(
+		`UPDATE idempotency_keys SET status_code = ?, response_headers = ?, response_body = ?
+		 WHERE user_id = ? AND idem_key = ?`,
+		recorder.status, string(rawHeaders), recorder.body.Bytes(), userId, key,
+	)
+	if err != nil {
+		log.Printf("Error guardando la respuesta de la Idempotency-Key %q: %v", key, err)
+		m.release(userId, key)
+	}
+}
+
+func (m *IdempotencyMiddleware) release(userId int, key string) {
+	_, err := m.DB.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ?", userId, key)
+	if err != nil {
+		log.Printf("Error liberando la Idempotency-Key %q: %v", key, err)
+	}
+}
+
+func replay(w http.ResponseWriter, record *idempotencyRecord) {
+	var headers map[string]string
+	if record.headers.Valid {
+		json.Unmarshal([]byte(record.headers.String), &headers)
+	}
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(record.status.Int64))
+	w.Write(record.body)
+}
+
+// responseRecorder copia la respuesta mientras se envía al cliente.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -3,33 +3,422 @@ package models
 import (
 	"database/sql"
 	"time"
+
+	"deliveryService/geo"
+	"deliveryService/money"
+	"deliveryService/pricing"
 )
 
 type User struct {
-	ID       int     `json:"id"`
-	Name     string  `json:"name"`
-	Password string  `json:"-"`
-	Role     string  `json:"role"` // "customer", "delivery"
-	Address  *string `json:"address,omitempty"`
+	ID             int      `json:"id"`
+	Name           string   `json:"name"`
+	Password       string   `json:"-"`
+	Role           string   `json:"role"` // "customer", "delivery", "admin", "establishment"
+	Address        *string  `json:"address,omitempty"`
+	AddressDetails *Address `json:"addressDetails,omitempty"`
+	Rating         *Rating  `json:"rating,omitempty"`
+}
+
+// Rating es la valoración media de un repartidor o establecimiento.
+type Rating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// Review es la valoración de un cliente sobre una orden entregada. Cada
+// orden admite una sola, con nota de 1 a 5 para el repartidor, el
+// establecimiento o ambos.
+type Review struct {
+	ID                   int       `json:"id"`
+	OrderID              int       `json:"orderId"`
+	UserID               int       `json:"userId"`
+	CourierID            *int      `json:"courierId,omitempty"`
+	EstablishmentID      *int      `json:"establishmentId,omitempty"`
+	CourierRating        *int      `json:"courierRating,omitempty" validate:"min=1,max=5"`
+	CourierComment       string    `json:"courierComment,omitempty" validate:"max=1000"`
+	EstablishmentRating  *int      `json:"establishmentRating,omitempty" validate:"min=1,max=5"`
+	EstablishmentComment string    `json:"establishmentComment,omitempty" validate:"max=1000"`
+	CreatedAt            time.Time `json:"createdAt"`
+}
+
+// OrderTemplate es una orden recurrente de un cliente. Days sigue
+// time.Weekday (0 = domingo) y Time usa "HH:MM"; en cada ocurrencia se crea
+// una orden programada para esa hora con los precios vigentes.
+type OrderTemplate struct {
+	ID               int          `json:"id"`
+	UserID           int          `json:"userId"`
+	EstablishmentID  int          `json:"establishmentId"`
+	Title            string       `json:"title" validate:"max=255"`
+	Items            []OrderItem  `json:"items" validate:"max=50"`
+	DeliveryLocation *geo.Point   `json:"deliveryLocation,omitempty"`
+	Tip              money.Amount `json:"tip" validate:"min=0"`
+	Days             []int        `json:"days" validate:"required,max=7"`
+	Time             string       `json:"time" validate:"required,clock"`
+	Active           bool         `json:"active"`
+	NextRunAt        *time.Time   `json:"nextRunAt,omitempty"`
+	LastOrderID      *int         `json:"lastOrderId,omitempty"`
+	CreatedAt        time.Time    `json:"createdAt"`
+	UpdatedAt        time.Time    `json:"updatedAt"`
+}
+
+// NextRunAfter devuelve la primera ocurrencia posterior a after. El
+// segundo valor es false si la plantilla no tiene días u hora válidos.
+func (t OrderTemplate) NextRunAfter(after time.Time) (time.Time, bool) {
+	minute, err := clockMinutes(t.Time)
+	if err != nil {
+		return time.Time{}, false
+	}
+	days := make(map[int]bool, len(t.Days))
+	for _, d := range t.Days {
+		days[d] = true
+	}
+
+	// Se revisa una semana y un día para cubrir el mismo día de la semana
+	// cuando la hora de hoy ya pasó
+	for i := 0; i <= 7; i++ {
+		next := time.Date(after.Year(), after.Month(), after.Day()+i, minute/60, minute%60, 0, 0, after.Location())
+		if days[int(next.Weekday())] && next.After(after) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Address es una dirección estructurada. Location se obtiene por
+// geocodificación si el cliente no la envía.
+type Address struct {
+	Street     string     `json:"street" validate:"required,max=255"`
+	City       string     `json:"city" validate:"required,max=120"`
+	PostalCode string     `json:"postalCode,omitempty" validate:"max=16"`
+	Notes      string     `json:"notes,omitempty" validate:"max=255"`
+	Location   *geo.Point `json:"location,omitempty"`
+}
+
+// String devuelve la dirección en una línea, para la columna de texto libre.
+func (a Address) String() string {
+	if a.PostalCode == "" {
+		return a.Street + ", " + a.City
+	}
+	return a.Street + ", " + a.PostalCode + " " + a.City
 }
 
 type Order struct {
+	ID                int          `json:"id"`
+	Title             string       `json:"title" validate:"max=255"`
+	Description       string       `json:"description" validate:"max=2000"`
+	Status            string       `json:"status"` // "scheduled", "pending", "pickup", "in_coming", "arrived", "delivered", "cancelled"
+	EstablishmentName string       `json:"establishmentName"`
+	EstablishmentAddr string       `json:"establishmentAddress"`
+	Price             money.Amount `json:"price"`
+	UserID            int          `json:"userId"`
+	DeliveryID        *int         `json:"deliveryId,omitempty"`
+	CreatedAt         time.Time    `json:"createdAt"`
+	UpdatedAt         time.Time    `json:"updatedAt"`
+	Version           int          `json:"version"`
+
+	EstablishmentID             *int     `json:"establishmentId,omitempty" validate:"required"`
+	EstablishmentAddressDetails *Address `json:"establishmentAddressDetails,omitempty"`
+	ZoneID                      *int     `json:"zoneId,omitempty"`
+	BatchID                     *int     `json:"batchId,omitempty"`
+	BatchSequence               *int     `json:"batchSequence,omitempty"`
+
+	EstablishmentLocation *geo.Point `json:"establishmentLocation,omitempty"`
+	DeliveryLocation      *geo.Point `json:"deliveryLocation,omitempty"`
+	EstimatedPickupAt     *time.Time `json:"estimatedPickupAt,omitempty"`
+	EstimatedDeliveryAt   *time.Time `json:"estimatedDeliveryAt,omitempty"`
+
+	Items          []OrderItem        `json:"items,omitempty" validate:"required,max=50"`
+	PromoCode      string             `json:"promoCode,omitempty" validate:"max=40"`
+	PriceBreakdown *pricing.Breakdown `json:"priceBreakdown,omitempty"`
+	PaymentStatus  string             `json:"paymentStatus,omitempty"`
+	Tip            money.Amount       `json:"tip" validate:"min=0"`
+	DeliveredAt    *time.Time         `json:"deliveredAt,omitempty"`
+	ScheduledFor   *time.Time         `json:"scheduledFor,omitempty"`
+}
+
+// OrderItem es una línea de la orden que referencia un producto del menú.
+// Nombre, precio unitario y modificadores se copian del menú al crear la
+// orden; el cliente solo envía menuItemId, quantity y modifierIds.
+type OrderItem struct {
+	MenuItemID  int                 `json:"menuItemId" validate:"required"`
+	Name        string              `json:"name"`
+	Quantity    int                 `json:"quantity" validate:"min=1,max=99"`
+	UnitPrice   money.Amount        `json:"unitPrice"`
+	ModifierIDs []int               `json:"modifierIds,omitempty" validate:"max=20"`
+	Modifiers   []OrderItemModifier `json:"modifiers"`
+	Total       money.Amount        `json:"total"`
+}
+
+type OrderItemModifier struct {
+	ID    int          `json:"id,omitempty"`
+	Name  string       `json:"name"`
+	Price money.Amount `json:"price"`
+}
+
+// ComputeTotal calcula el total de la línea: (precio unitario más
+// modificadores) por cantidad.
+func (i *OrderItem) ComputeTotal() money.Amount {
+	unit := i.UnitPrice
+	for _, m := range i.Modifiers {
+		unit += m.Price
+	}
+	i.Total = unit.Mul(i.Quantity)
+	return i.Total
+}
+
+// Establishment es un comercio con su propietario, horario y menú.
+type Establishment struct {
+	ID           int            `json:"id"`
+	OwnerID      int            `json:"ownerId"`
+	Name         string         `json:"name" validate:"required,max=255"`
+	Description  string         `json:"description" validate:"max=2000"`
+	Address      *Address       `json:"address" validate:"required"`
+	OpeningHours []OpeningHours `json:"openingHours" validate:"max=50"`
+	Active       bool           `json:"active"`
+	Menu         []MenuItem     `json:"menu,omitempty"`
+	Rating       *Rating        `json:"rating,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+}
+
+// OpeningHours es una franja de apertura. Day sigue time.Weekday
+// (0 = domingo); Open y Close usan "HH:MM" y Close puede pasar de medianoche.
+type OpeningHours struct {
+	Day   int    `json:"day" validate:"min=0,max=6"`
+	Open  string `json:"open" validate:"required,clock"`
+	Close string `json:"close" validate:"required,clock"`
+}
+
+// IsOpenAt indica si el establecimiento abre en t. Sin horario configurado
+// se considera siempre abierto.
+func (e Establishment) IsOpenAt(t time.Time) bool {
+	if len(e.OpeningHours) == 0 {
+		return true
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	today := int(t.Weekday())
+	yesterday := (today + 6) % 7
+	for _, h := range e.OpeningHours {
+		open, errOpen := clockMinutes(h.Open)
+		close, errClose := clockMinutes(h.Close)
+		if errOpen != nil || errClose != nil {
+			continue
+		}
+		if close > open {
+			if h.Day == today && minute >= open && minute < close {
+				return true
+			}
+			continue
+		}
+		// Franja que cruza la medianoche
+		if (h.Day == today && minute >= open) || (h.Day == yesterday && minute < close) {
+			return true
+		}
+	}
+	return false
+}
+
+func clockMinutes(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+type MenuItem struct {
+	ID              int            `json:"id"`
+	EstablishmentID int            `json:"establishmentId"`
+	Name            string         `json:"name" validate:"required,max=255"`
+	Description     string         `json:"description" validate:"max=2000"`
+	Price           money.Amount   `json:"price" validate:"gt=0"`
+	Available       bool           `json:"available"`
+	Modifiers       []MenuModifier `json:"modifiers" validate:"max=50"`
+}
+
+// MenuModifier es un extra opcional de un producto (p. ej. "Extra queso").
+type MenuModifier struct {
+	ID    int          `json:"id"`
+	Name  string       `json:"name" validate:"required,max=255"`
+	Price money.Amount `json:"price" validate:"min=0"`
+}
+
+// Payment es el pago de una orden en la pasarela. Se autoriza al crear la
+// orden, se captura al entregarla y se anula si se cancela.
+type Payment struct {
+	ID                int          `json:"id"`
+	OrderID           int          `json:"orderId"`
+	Provider          string       `json:"provider"`
+	ProviderReference string       `json:"providerReference"`
+	Amount            money.Amount `json:"amount"`
+	CapturedAmount    money.Amount `json:"capturedAmount"`
+	RefundedAmount    money.Amount `json:"refundedAmount"`
+	Status            string       `json:"status"` // "authorized", "captured", "voided", "partially_refunded", "refunded"
+	CreatedAt         time.Time    `json:"createdAt"`
+	UpdatedAt         time.Time    `json:"updatedAt"`
+}
+
+// Refund es una devolución sobre un pago capturado. La suma de las
+// devoluciones de un pago nunca supera lo capturado. Se registra como
+// "pending" antes de llamar a la pasarela y pasa a "completed" o "failed"
+// con su respuesta.
+type Refund struct {
+	ID                int          `json:"id"`
+	OrderID           int          `json:"orderId"`
+	PaymentID         int          `json:"paymentId"`
+	Amount            money.Amount `json:"amount"`
+	Reason            string       `json:"reason"` // "missing_item", "wrong_item", "damaged", "late_delivery", "other"
+	Notes             string       `json:"notes,omitempty"`
+	Status            string       `json:"status"` // "pending", "completed", "failed"
+	ProviderReference string       `json:"providerReference,omitempty"`
+	CreatedBy         int          `json:"createdBy"`
+	CreatedAt         time.Time    `json:"createdAt"`
+}
+
+// CourierEarning es lo que gana un repartidor por una orden entregada.
+type CourierEarning struct {
+	ID          int          `json:"id"`
+	OrderID     int          `json:"orderId"`
+	CourierID   int          `json:"courierId"`
+	BaseFee     money.Amount `json:"baseFee"`
+	DistanceFee money.Amount `json:"distanceFee"`
+	DistanceKm  float64      `json:"distanceKm"`
+	Tip         money.Amount `json:"tip"`
+	Total       money.Amount `json:"total"`
+	PayoutID    *int         `json:"payoutId,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+// EarningsSummary resume las ganancias de un repartidor en un periodo.
+// Balance es el saldo pendiente de pago según el libro contable.
+type EarningsSummary struct {
+	From         time.Time        `json:"from"`
+	To           time.Time        `json:"to"`
+	Orders       int              `json:"orders"`
+	BaseFees     money.Amount     `json:"baseFees"`
+	DistanceFees money.Amount     `json:"distanceFees"`
+	Tips         money.Amount     `json:"tips"`
+	Total        money.Amount     `json:"total"`
+	Balance      money.Amount     `json:"balance"`
+	Earnings     []CourierEarning `json:"earnings"`
+}
+
+// Promotion es un código de descuento. Value es un porcentaje (15.00 = 15%)
+// o un importe fijo según Kind; los límites y restricciones nulos no aplican.
+type Promotion struct {
+	ID              int           `json:"id"`
+	Code            string        `json:"code" validate:"required,max=40"`
+	Kind            string        `json:"kind" validate:"required,oneof=percentage fixed"` // "percentage", "fixed"
+	Value           money.Amount  `json:"value" validate:"gt=0"`
+	MinOrder        *money.Amount `json:"minOrder,omitempty" validate:"min=0"`
+	MaxUses         *int          `json:"maxUses,omitempty" validate:"min=1"`
+	MaxUsesPerUser  *int          `json:"maxUsesPerUser,omitempty" validate:"min=1"`
+	StartsAt        *time.Time    `json:"startsAt,omitempty"`
+	EndsAt          *time.Time    `json:"endsAt,omitempty"`
+	EstablishmentID *int          `json:"establishmentId,omitempty"`
+	Active          bool          `json:"active"`
+	Uses            int           `json:"uses"`
+	CreatedAt       time.Time     `json:"createdAt"`
+}
+
+// Discount calcula el descuento sobre el subtotal, sin superarlo.
+func (p Promotion) Discount(subtotal money.Amount) money.Amount {
+	discount := p.Value
+	if p.Kind == "percentage" {
+		// 15.00 se guarda como 1500 centavos, que son justo 1500 puntos básicos
+		discount = subtotal.MulRate(int64(p.Value))
+	}
+	if discount > subtotal {
+		discount = subtotal
+	}
+	return discount
+}
+
+// ActiveAt indica si la promoción está activa y dentro de su vigencia.
+func (p Promotion) ActiveAt(t time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	return p.EndsAt == nil || t.Before(*p.EndsAt)
+}
+
+// Batch agrupa órdenes del mismo establecimiento asignadas a un repartidor.
+// Orders viene ordenado según la secuencia de paradas calculada.
+type Batch struct {
 	ID                int       `json:"id"`
-	Title             string    `json:"title"`
-	Description       string    `json:"description"`
-	Status            string    `json:"status"` // "pending", "pickup", "in_coming", "arrived", "delivered"
+	DeliveryID        int       `json:"deliveryId"`
+	Status            string    `json:"status"`
 	EstablishmentName string    `json:"establishmentName"`
-	EstablishmentAddr string    `json:"establishmentAddress"`
-	Price             float64   `json:"price"`
-	UserID            int       `json:"userId"`
-	DeliveryID        *int      `json:"deliveryId,omitempty"`
+	RouteKm           float64   `json:"routeKm"`
+	Orders            []Order   `json:"orders"`
 	CreatedAt         time.Time `json:"createdAt"`
 	UpdatedAt         time.Time `json:"updatedAt"`
 }
 
+// Zone es un área de cobertura: un polígono o un círculo (centro y radio).
+type Zone struct {
+	ID       int         `json:"id"`
+	Name     string      `json:"name" validate:"required,max=255"`
+	Kind     string      `json:"kind" validate:"required,oneof=polygon radius"` // "polygon", "radius"
+	Polygon  []geo.Point `json:"polygon,omitempty" validate:"max=500"`
+	Center   *geo.Point  `json:"center,omitempty"`
+	RadiusKm float64     `json:"radiusKm,omitempty" validate:"min=0"`
+	Active   bool        `json:"active"`
+	// DeliveryFee fija el envío dentro de la zona; sin ella se cobra por distancia
+	DeliveryFee *money.Amount `json:"deliveryFee,omitempty" validate:"min=0"`
+}
+
+func (z Zone) Contains(p geo.Point) bool {
+	switch z.Kind {
+	case "polygon":
+		return geo.InPolygon(p, z.Polygon)
+	case "radius":
+		return z.Center != nil && geo.DistanceKm(*z.Center, p) <= z.RadiusKm
+	}
+	return false
+}
+
+// LocationPoint es una posición GPS reportada por un repartidor.
+type LocationPoint struct {
+	OrderID             int        `json:"orderId,omitempty"`
+	Lat                 float64    `json:"lat"`
+	Lng                 float64    `json:"lng"`
+	RecordedAt          time.Time  `json:"recordedAt"`
+	EstimatedDeliveryAt *time.Time `json:"estimatedDeliveryAt,omitempty"`
+}
+
+// CourierStatus es la disponibilidad de un repartidor para recibir órdenes.
+type CourierStatus struct {
+	UserID          int       `json:"userId"`
+	Availability    string    `json:"availability"` // "online", "paused", "offline"
+	ActiveOrders    int       `json:"activeOrders"`
+	MaxActiveOrders int       `json:"maxActiveOrders"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
 type LoginRequest struct {
-	Name     string `json:"name"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,max=128"`
+}
+
+// RegisterRequest es el cuerpo de POST /register y POST /api/users.
+type RegisterRequest struct {
+	Name           string   `json:"name" validate:"required,max=255"`
+	Password       string   `json:"password" validate:"required,min=4,max=128"`
+	Role           string   `json:"role" validate:"required,oneof=customer delivery establishment"`
+	Address        *string  `json:"address,omitempty" validate:"max=500"`
+	AddressDetails *Address `json:"addressDetails,omitempty"`
+}
+
+// UpdateUserRequest es el cuerpo de PUT /api/users/{id}.
+type UpdateUserRequest struct {
+	Name           string   `json:"name" validate:"required,max=255"`
+	Address        *string  `json:"address,omitempty" validate:"max=500"`
+	AddressDetails *Address `json:"addressDetails,omitempty"`
 }
 
 type LoginResponse struct {
@@ -56,10 +445,21 @@ func CreateTables(db *sql.DB) error {
 		id INT AUTO_INCREMENT PRIMARY KEY,
 		name VARCHAR(255) UNIQUE NOT NULL,
 		password VARCHAR(255) NOT NULL,
-		role ENUM('customer', 'delivery') NOT NULL,
+		role ENUM('customer', 'delivery', 'admin', 'establishment') NOT NULL,
 		address TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		deleted_at TIMESTAMP NULL DEFAULT NULL,
+		address_street VARCHAR(255) NULL,
+		address_city VARCHAR(120) NULL,
+		address_postal_code VARCHAR(16) NULL,
+		address_notes VARCHAR(255) NULL,
+		address_lat DECIMAL(9,6) NULL,
+		address_lng DECIMAL(9,6) NULL,
+		availability ENUM('online', 'paused', 'offline') NOT NULL DEFAULT 'offline',
+		availability_updated_at TIMESTAMP NULL DEFAULT NULL,
+		max_active_orders INT NOT NULL DEFAULT 3,
+		INDEX idx_users_deleted_at (deleted_at)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
 
 	// Tabla de órdenes - MySQL syntax
@@ -68,7 +468,7 @@ func CreateTables(db *sql.DB) error {
 		id INT AUTO_INCREMENT PRIMARY KEY,
 		title VARCHAR(255) NOT NULL,
 		description TEXT NOT NULL,
-		status ENUM('pending', 'pickup', 'in_coming', 'arrived', 'delivered') NOT NULL,
+		status ENUM('scheduled', 'pending', 'pickup', 'in_coming', 'arrived', 'delivered', 'cancelled') NOT NULL,
 		establishmentName VARCHAR(255) NOT NULL,
 		establishmentAddress TEXT NOT NULL,
 		price DECIMAL(10,2) NOT NULL,
@@ -76,11 +476,42 @@ func CreateTables(db *sql.DB) error {
 		delivery_id INT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		deleted_at TIMESTAMP NULL DEFAULT NULL,
+		version INT NOT NULL DEFAULT 1,
+		establishment_street VARCHAR(255) NULL,
+		establishment_city VARCHAR(120) NULL,
+		establishment_postal_code VARCHAR(16) NULL,
+		establishment_notes VARCHAR(255) NULL,
+		subtotal DECIMAL(10,2) NULL,
+		delivery_fee DECIMAL(10,2) NULL,
+		service_fee DECIMAL(10,2) NULL,
+		tax DECIMAL(10,2) NULL,
+		surge_multiplier DECIMAL(4,2) NULL,
+		promo_code VARCHAR(40) NULL,
+		discount DECIMAL(10,2) NULL,
+		tip DECIMAL(10,2) NOT NULL DEFAULT 0,
+		delivered_at TIMESTAMP NULL DEFAULT NULL,
+		scheduled_for TIMESTAMP NULL DEFAULT NULL,
+		establishment_lat DECIMAL(9,6) NULL,
+		establishment_lng DECIMAL(9,6) NULL,
+		delivery_lat DECIMAL(9,6) NULL,
+		delivery_lng DECIMAL(9,6) NULL,
+		estimated_pickup_at TIMESTAMP NULL DEFAULT NULL,
+		estimated_delivery_at TIMESTAMP NULL DEFAULT NULL,
+		zone_id INT NULL,
+		batch_id INT NULL,
+		batch_seq INT NULL,
+		establishment_id INT NULL,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 		FOREIGN KEY (delivery_id) REFERENCES users(id) ON DELETE SET NULL,
+		FOREIGN KEY (zone_id) REFERENCES delivery_zones(id) ON DELETE SET NULL,
+		FOREIGN KEY (batch_id) REFERENCES delivery_batches(id) ON DELETE SET NULL,
+		FOREIGN KEY (establishment_id) REFERENCES establishments(id) ON DELETE SET NULL,
 		INDEX idx_user_id (user_id),
 		INDEX idx_delivery_id (delivery_id),
-		INDEX idx_status (status)
+		INDEX idx_status (status),
+		INDEX idx_orders_scheduled_for (status, scheduled_for),
+		INDEX idx_orders_deleted_at (deleted_at)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
 
 	_, err = db.Exec(userTable)
@@ -88,7 +519,429 @@ func CreateTables(db *sql.DB) error {
 		return err
 	}
 
-	_, err = db.Exec(orderTable)
+	// Última posición conocida de cada repartidor
+	courierLocationTable := `
+	CREATE TABLE IF NOT EXISTS courier_locations (
+		courier_id INT PRIMARY KEY,
+		lat DECIMAL(9,6) NOT NULL,
+		lng DECIMAL(9,6) NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (courier_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Recorrido del repartidor mientras la orden está en camino
+	orderTrailTable := `
+	CREATE TABLE IF NOT EXISTS order_location_trail (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		order_id INT NOT NULL,
+		courier_id INT NOT NULL,
+		lat DECIMAL(9,6) NOT NULL,
+		lng DECIMAL(9,6) NOT NULL,
+		recorded_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		FOREIGN KEY (courier_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_trail_order (order_id, recorded_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Zonas de cobertura; polygon guarda los vértices como JSON
+	zoneTable := `
+	CREATE TABLE IF NOT EXISTS delivery_zones (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(120) NOT NULL,
+		kind ENUM('polygon', 'radius') NOT NULL,
+		polygon TEXT NULL,
+		center_lat DECIMAL(9,6) NULL,
+		center_lng DECIMAL(9,6) NULL,
+		radius_km DECIMAL(8,3) NULL,
+		delivery_fee DECIMAL(10,2) NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Lotes de entrega con varias paradas
+	batchTable := `
+	CREATE TABLE IF NOT EXISTS delivery_batches (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		delivery_id INT NOT NULL,
+		status ENUM('pickup', 'in_coming', 'arrived', 'delivered') NOT NULL,
+		establishmentName VARCHAR(255) NOT NULL,
+		route_km DECIMAL(8,3) NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (delivery_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_batches_delivery (delivery_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Establecimientos; opening_hours guarda las franjas como JSON
+	establishmentTable := `
+	CREATE TABLE IF NOT EXISTS establishments (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		owner_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL,
+		address_street VARCHAR(255) NOT NULL,
+		address_city VARCHAR(120) NOT NULL,
+		address_postal_code VARCHAR(16) NULL,
+		address_notes VARCHAR(255) NULL,
+		address_lat DECIMAL(9,6) NULL,
+		address_lng DECIMAL(9,6) NULL,
+		opening_hours TEXT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_establishments_owner (owner_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	menuItemTable := `
+	CREATE TABLE IF NOT EXISTS menu_items (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		establishment_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL,
+		price DECIMAL(10,2) NOT NULL,
+		available BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (establishment_id) REFERENCES establishments(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	paymentTable := `
+	CREATE TABLE IF NOT EXISTS payments (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		order_id INT NOT NULL,
+		provider VARCHAR(40) NOT NULL,
+		provider_reference VARCHAR(120) NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		captured_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+		refunded_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+		status ENUM('authorized', 'captured', 'voided', 'partially_refunded', 'refunded') NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		INDEX idx_payments_order (order_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	refundTable := `
+	CREATE TABLE IF NOT EXISTS refunds (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		order_id INT NOT NULL,
+		payment_id INT NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		reason ENUM('missing_item', 'wrong_item', 'damaged', 'late_delivery', 'other') NOT NULL,
+		notes TEXT NULL,
+		status ENUM('pending', 'completed', 'failed') NOT NULL DEFAULT 'completed',
+		provider_reference VARCHAR(120) NULL,
+		created_by INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE,
+		INDEX idx_refunds_order (order_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	reviewTable := `
+	CREATE TABLE IF NOT EXISTS reviews (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		order_id INT NOT NULL UNIQUE,
+		user_id INT NOT NULL,
+		courier_id INT NULL,
+		establishment_id INT NULL,
+		courier_rating TINYINT NULL,
+		courier_comment TEXT NULL,
+		establishment_rating TINYINT NULL,
+		establishment_comment TEXT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		FOREIGN KEY (courier_id) REFERENCES users(id) ON DELETE SET NULL,
+		FOREIGN KEY (establishment_id) REFERENCES establishments(id) ON DELETE SET NULL,
+		INDEX idx_reviews_courier (courier_id),
+		INDEX idx_reviews_establishment (establishment_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Plantillas de órdenes recurrentes; items y days se guardan como JSON
+	orderTemplateTable := `
+	CREATE TABLE IF NOT EXISTS order_templates (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		establishment_id INT NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		items TEXT NOT NULL,
+		delivery_lat DECIMAL(9,6) NULL,
+		delivery_lng DECIMAL(9,6) NULL,
+		tip DECIMAL(10,2) NOT NULL DEFAULT 0,
+		days VARCHAR(32) NOT NULL,
+		run_time CHAR(5) NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		next_run_at TIMESTAMP NULL DEFAULT NULL,
+		last_order_id INT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (establishment_id) REFERENCES establishments(id) ON DELETE CASCADE,
+		FOREIGN KEY (last_order_id) REFERENCES orders(id) ON DELETE SET NULL,
+		INDEX idx_order_templates_user (user_id),
+		INDEX idx_order_templates_next_run (active, next_run_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Respuestas guardadas por Idempotency-Key; status_code es NULL mientras
+	// la petición original sigue en curso
+	idempotencyTable := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL DEFAULT 0,
+		idem_key VARCHAR(255) NOT NULL,
+		fingerprint CHAR(64) NOT NULL,
+		status_code INT NULL,
+		response_headers TEXT NULL,
+		response_body MEDIUMBLOB NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		UNIQUE KEY uq_idempotency_key (user_id, idem_key),
+		INDEX idx_idempotency_expires (expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Ganancias de repartidores y libro contable de partida doble
+	earningTable := `
+	CREATE TABLE IF NOT EXISTS courier_earnings (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		order_id INT NOT NULL,
+		courier_id INT NOT NULL,
+		tip_payment_id INT NOT NULL DEFAULT 0,
+		base_fee DECIMAL(10,2) NOT NULL,
+		distance_fee DECIMAL(10,2) NOT NULL,
+		distance_km DECIMAL(8,2) NOT NULL DEFAULT 0,
+		tip DECIMAL(10,2) NOT NULL DEFAULT 0,
+		total DECIMAL(10,2) NOT NULL,
+		payout_id INT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		FOREIGN KEY (courier_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (payout_id) REFERENCES payouts(id) ON DELETE SET NULL,
+		UNIQUE KEY uq_earnings_order (order_id, tip_payment_id),
+		INDEX idx_earnings_courier (courier_id, created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	payoutTable := `
+	CREATE TABLE IF NOT EXISTS payouts (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		courier_id INT NOT NULL,
+		week_start DATE NOT NULL,
+		total DECIMAL(10,2) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (courier_id) REFERENCES users(id) ON DELETE CASCADE,
+		UNIQUE KEY uq_payouts_week (courier_id, week_start)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	ledgerTransactionTable := `
+	CREATE TABLE IF NOT EXISTS ledger_transactions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		kind VARCHAR(40) NOT NULL,
+		reference VARCHAR(80) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	ledgerEntryTable := `
+	CREATE TABLE IF NOT EXISTS ledger_entries (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		transaction_id INT NOT NULL,
+		account VARCHAR(80) NOT NULL,
+		debit DECIMAL(12,2) NOT NULL DEFAULT 0,
+		credit DECIMAL(12,2) NOT NULL DEFAULT 0,
+		FOREIGN KEY (transaction_id) REFERENCES ledger_transactions(id) ON DELETE CASCADE,
+		INDEX idx_ledger_account (account)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	// Códigos promocionales y su uso por orden
+	promotionTable := `
+	CREATE TABLE IF NOT EXISTS promotions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		code VARCHAR(40) NOT NULL UNIQUE,
+		kind ENUM('percentage', 'fixed') NOT NULL,
+		value DECIMAL(10,2) NOT NULL,
+		min_order DECIMAL(10,2) NULL,
+		max_uses INT NULL,
+		max_uses_per_user INT NULL,
+		starts_at TIMESTAMP NULL DEFAULT NULL,
+		ends_at TIMESTAMP NULL DEFAULT NULL,
+		establishment_id INT NULL,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (establishment_id) REFERENCES establishments(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	redemptionTable := `
+	CREATE TABLE IF NOT EXISTS promotion_redemptions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		promotion_id INT NOT NULL,
+		user_id INT NOT NULL,
+		order_id INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (promotion_id) REFERENCES promotions(id) ON DELETE CASCADE,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		INDEX idx_redemptions_user (promotion_id, user_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	menuModifierTable := `
+	CREATE TABLE IF NOT EXISTS menu_item_modifiers (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		menu_item_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		price DECIMAL(10,2) NOT NULL DEFAULT 0,
+		FOREIGN KEY (menu_item_id) REFERENCES menu_items(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	orderItemTable := `
+	CREATE TABLE IF NOT EXISTS order_items (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		order_id INT NOT NULL,
+		menu_item_id INT NULL,
+		name VARCHAR(255) NOT NULL,
+		quantity INT NOT NULL,
+		unit_price DECIMAL(10,2) NOT NULL DEFAULT 0,
+		modifiers TEXT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+		FOREIGN KEY (menu_item_id) REFERENCES menu_items(id) ON DELETE SET NULL,
+		INDEX idx_order_items_order (order_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+	tables := []string{
+		zoneTable, establishmentTable, menuItemTable, menuModifierTable, batchTable,
+		orderTable, orderItemTable, paymentTable, refundTable, promotionTable, redemptionTable,
+		courierLocationTable, orderTrailTable, payoutTable, earningTable,
+		ledgerTransactionTable, ledgerEntryTable, reviewTable, orderTemplateTable, idempotencyTable,
+	}
+	for _, table := range tables {
+		_, err = db.Exec(table)
+		if err != nil {
+			return err
+		}
+	}
+
+	return migrate(db)
+}
+
+// migrate aplica los cambios de esquema sobre tablas creadas por versiones
+// anteriores, donde CREATE TABLE IF NOT EXISTS no tiene efecto.
+func migrate(db *sql.DB) error {
+	_, err := db.Exec("ALTER TABLE users MODIFY role ENUM('customer', 'delivery', 'admin', 'establishment') NOT NULL")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE orders MODIFY status ENUM('scheduled', 'pending', 'pickup', 'in_coming', 'arrived', 'delivered', 'cancelled') NOT NULL")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE payments MODIFY status ENUM('authorized', 'captured', 'voided', 'partially_refunded', 'refunded') NOT NULL")
+	if err != nil {
+		return err
+	}
+	// La referencia de la pasarela se conoce después de registrar el reembolso
+	_, err = db.Exec("ALTER TABLE refunds MODIFY provider_reference VARCHAR(120) NULL")
+	if err != nil {
+		return err
+	}
+
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"users", "deleted_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"orders", "deleted_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"orders", "version", "INT NOT NULL DEFAULT 1"},
+		{"users", "availability", "ENUM('online', 'paused', 'offline') NOT NULL DEFAULT 'offline'"},
+		{"users", "availability_updated_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"users", "max_active_orders", "INT NOT NULL DEFAULT 3"},
+		{"orders", "establishment_lat", "DECIMAL(9,6) NULL"},
+		{"orders", "establishment_lng", "DECIMAL(9,6) NULL"},
+		{"orders", "delivery_lat", "DECIMAL(9,6) NULL"},
+		{"orders", "delivery_lng", "DECIMAL(9,6) NULL"},
+		{"orders", "estimated_pickup_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"orders", "estimated_delivery_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"users", "address_street", "VARCHAR(255) NULL"},
+		{"users", "address_city", "VARCHAR(120) NULL"},
+		{"users", "address_postal_code", "VARCHAR(16) NULL"},
+		{"users", "address_notes", "VARCHAR(255) NULL"},
+		{"users", "address_lat", "DECIMAL(9,6) NULL"},
+		{"users", "address_lng", "DECIMAL(9,6) NULL"},
+		{"orders", "establishment_street", "VARCHAR(255) NULL"},
+		{"orders", "establishment_city", "VARCHAR(120) NULL"},
+		{"orders", "establishment_postal_code", "VARCHAR(16) NULL"},
+		{"orders", "establishment_notes", "VARCHAR(255) NULL"},
+		{"orders", "zone_id", "INT NULL"},
+		{"orders", "batch_id", "INT NULL"},
+		{"orders", "batch_seq", "INT NULL"},
+		{"orders", "establishment_id", "INT NULL"},
+		{"order_items", "unit_price", "DECIMAL(10,2) NOT NULL DEFAULT 0"},
+		{"order_items", "modifiers", "TEXT NULL"},
+		{"delivery_zones", "delivery_fee", "DECIMAL(10,2) NULL"},
+		{"orders", "subtotal", "DECIMAL(10,2) NULL"},
+		{"orders", "delivery_fee", "DECIMAL(10,2) NULL"},
+		{"orders", "service_fee", "DECIMAL(10,2) NULL"},
+		{"orders", "tax", "DECIMAL(10,2) NULL"},
+		{"orders", "surge_multiplier", "DECIMAL(4,2) NULL"},
+		{"orders", "promo_code", "VARCHAR(40) NULL"},
+		{"orders", "discount", "DECIMAL(10,2) NULL"},
+		{"payments", "refunded_amount", "DECIMAL(10,2) NOT NULL DEFAULT 0"},
+		{"orders", "tip", "DECIMAL(10,2) NOT NULL DEFAULT 0"},
+		{"orders", "delivered_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"orders", "scheduled_for", "TIMESTAMP NULL DEFAULT NULL"},
+		{"refunds", "status", "ENUM('pending', 'completed', 'failed') NOT NULL DEFAULT 'completed'"},
+		{"courier_earnings", "tip_payment_id", "INT NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Una orden tiene una ganancia por la entrega (tip_payment_id = 0) y una
+	// más por cada aumento de propina posterior. El índice nuevo se crea
+	// antes de quitar el antiguo porque la clave foránea de order_id lo usa.
+	if err := addIndexIfMissing(db, "courier_earnings", "uq_earnings_order", "UNIQUE KEY uq_earnings_order (order_id, tip_payment_id)"); err != nil {
+		return err
+	}
+	return dropIndexIfExists(db, "courier_earnings", "order_id")
+}
+
+func indexExists(db *sql.DB, table, index string) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM information_schema.STATISTICS
+		 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`,
+		table, index,
+	).Scan(&count)
+	return count > 0, err
+}
+
+func addIndexIfMissing(db *sql.DB, table, index, definition string) error {
+	exists, err := indexExists(db, table, index)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD " + definition)
+	return err
+}
+
+func dropIndexIfExists(db *sql.DB, table, index string) error {
+	exists, err := indexExists(db, table, index)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " DROP INDEX " + index)
+	return err
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM information_schema.COLUMNS
+		 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		table, column,
+	).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
 	return err
 }
 
@@ -112,5 +965,44 @@ func SeedDatabase(db *sql.DB) error {
 			return err
 		}
 	}
-	return nil
+
+	// Garantizar al menos un administrador para los endpoints de /api/admin
+	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		_, err = db.Exec("INSERT INTO users (name, password, role) VALUES ('admin', '123456', 'admin')")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Establecimiento de ejemplo con su propietario y menú
+	err = db.QueryRow("SELECT COUNT(*) FROM establishments").Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	result, err := db.Exec("INSERT INTO users (name, password, role) VALUES ('restaurante1', '123456', 'establishment')")
+	if err != nil {
+		return err
+	}
+	ownerId, _ := result.LastInsertId()
+	result, err = db.Exec(`
+		INSERT INTO establishments (owner_id, name, description, address_street, address_city, opening_hours)
+		VALUES (?, 'Restaurante Demo', 'Comida casera', 'Calle Restaurante 1', 'Ciudad', NULL)`,
+		ownerId,
+	)
+	if err != nil {
+		return err
+	}
+	establishmentId, _ := result.LastInsertId()
+	_, err = db.Exec(`
+		INSERT INTO menu_items (establishment_id, name, description, price) VALUES
+		(?, 'Hamburguesa', 'Hamburguesa con queso', 95.00),
+		(?, 'Papas fritas', 'Porción mediana', 40.00),
+		(?, 'Refresco', 'Lata 355 ml', 25.00)`,
+		establishmentId, establishmentId, establishmentId,
+	)
+	return err
 }
\ No newline at end of file
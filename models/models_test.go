@@ -0,0 +1,163 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"deliveryService/geo"
+	"deliveryService/money"
+)
+
+func TestZoneContains(t *testing.T) {
+	square := []geo.Point{{Lat: 19.40, Lng: -99.20}, {Lat: 19.40, Lng: -99.10}, {Lat: 19.50, Lng: -99.10}, {Lat: 19.50, Lng: -99.20}}
+	center := geo.Point{Lat: 19.43, Lng: -99.13}
+
+	tests := []struct {
+		name string
+		zone Zone
+		p    geo.Point
+		want bool
+	}{
+		{"dentro del polígono", Zone{Kind: "polygon", Polygon: square}, geo.Point{Lat: 19.45, Lng: -99.15}, true},
+		{"fuera del polígono", Zone{Kind: "polygon", Polygon: square}, geo.Point{Lat: 19.55, Lng: -99.15}, false},
+		{"polígono sin vértices", Zone{Kind: "polygon"}, center, false},
+		{"en el centro del radio", Zone{Kind: "radius", Center: &center, RadiusKm: 2}, center, true},
+		// 0.01° de latitud son unos 1.1 km
+		{"dentro del radio", Zone{Kind: "radius", Center: &center, RadiusKm: 2}, geo.Point{Lat: 19.44, Lng: -99.13}, true},
+		{"fuera del radio", Zone{Kind: "radius", Center: &center, RadiusKm: 1}, geo.Point{Lat: 19.44, Lng: -99.13}, false},
+		{"radio sin centro", Zone{Kind: "radius", RadiusKm: 100}, center, false},
+		{"tipo desconocido", Zone{Kind: "circle", Center: &center, RadiusKm: 100}, center, false},
+	}
+	for _, tt := range tests {
+		if got := tt.zone.Contains(tt.p); got != tt.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestIsOpenAt(t *testing.T) {
+	e := Establishment{OpeningHours: []OpeningHours{
+		{Day: 1, Open: "09:00", Close: "14:00"},
+		{Day: 5, Open: "20:00", Close: "02:00"},
+		{Day: 6, Open: "22:00", Close: "00:00"},
+		{Day: 0, Open: "23:00", Close: "01:00"},
+		{Day: 2, Open: "25:00", Close: "26:00"},
+	}}
+	// 19 de octubre de 2026 es lunes
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{"lunes al abrir", at(19, 9, 0), true},
+		{"lunes antes de abrir", at(19, 8, 59), false},
+		{"lunes antes de cerrar", at(19, 13, 59), true},
+		{"lunes al cerrar", at(19, 14, 0), false},
+		{"martes con franja inválida", at(20, 10, 0), false},
+		{"viernes antes de abrir", at(23, 19, 59), false},
+		{"viernes por la noche", at(23, 23, 59), true},
+		{"viernes de madrugada no usa la franja del viernes", at(23, 1, 0), false},
+		{"sábado de madrugada por la franja del viernes", at(24, 1, 30), true},
+		{"sábado al cerrar la franja del viernes", at(24, 2, 0), false},
+		{"sábado por la noche", at(24, 23, 0), true},
+		{"cierre a medianoche", at(25, 0, 0), false},
+		{"lunes de madrugada por la franja del domingo", at(26, 0, 30), true},
+		{"lunes al cerrar la franja del domingo", at(26, 1, 0), false},
+	}
+	for _, tt := range tests {
+		if got := e.IsOpenAt(tt.t); got != tt.want {
+			t.Errorf("%s: IsOpenAt(%s) = %v, want %v", tt.name, tt.t.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+
+	if !(Establishment{}).IsOpenAt(at(19, 3, 0)) {
+		t.Error("sin horario el establecimiento debe estar siempre abierto")
+	}
+}
+
+func TestNextRunAfter(t *testing.T) {
+	loc := time.FixedZone("CST", -6*3600)
+	// 19 de octubre de 2026 es lunes
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, loc)
+	}
+	weekdays := OrderTemplate{Days: []int{1, 3}, Time: "08:30"}
+
+	tests := []struct {
+		name     string
+		template OrderTemplate
+		after    time.Time
+		want     time.Time
+		wantOK   bool
+	}{
+		{"hoy antes de la hora", weekdays, at(19, 7, 0), at(19, 8, 30), true},
+		{"justo a la hora pasa a la siguiente", weekdays, at(19, 8, 30), at(21, 8, 30), true},
+		{"siguiente semana", weekdays, at(21, 9, 0), at(26, 8, 30), true},
+		{"mismo día de la semana siguiente", OrderTemplate{Days: []int{1}, Time: "08:30"}, at(19, 9, 0), at(26, 8, 30), true},
+		{"domingo tras sábado", OrderTemplate{Days: []int{0}, Time: "00:00"}, at(24, 23, 59), at(25, 0, 0), true},
+		{"sin días", OrderTemplate{Time: "08:30"}, at(19, 7, 0), time.Time{}, false},
+		{"día fuera de rango", OrderTemplate{Days: []int{7}, Time: "08:30"}, at(19, 7, 0), time.Time{}, false},
+		{"hora inválida", OrderTemplate{Days: []int{1}, Time: "8h30"}, at(19, 7, 0), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.template.NextRunAfter(tt.after)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("%s: NextRunAfter(%s) = %s, %v; want %s, %v", tt.name, tt.after, got, ok, tt.want, tt.wantOK)
+			continue
+		}
+		if ok && got.Location() != loc {
+			t.Errorf("%s: NextRunAfter cambió la zona horaria a %s", tt.name, got.Location())
+		}
+	}
+}
+
+func TestPromotionDiscount(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion Promotion
+		subtotal  money.Amount
+		want      money.Amount
+	}{
+		{"porcentaje", Promotion{Kind: "percentage", Value: 1500}, 20000, 3000},
+		{"porcentaje con redondeo", Promotion{Kind: "percentage", Value: 1500}, 1234, 185}, // 185.1
+		{"cien por ciento", Promotion{Kind: "percentage", Value: 10000}, 4550, 4550},
+		{"porcentaje mayor al cien se limita al subtotal", Promotion{Kind: "percentage", Value: 15000}, 4550, 4550},
+		{"importe fijo", Promotion{Kind: "fixed", Value: 5000}, 20000, 5000},
+		{"importe fijo mayor al subtotal", Promotion{Kind: "fixed", Value: 5000}, 3000, 3000},
+		{"subtotal cero", Promotion{Kind: "fixed", Value: 5000}, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.promotion.Discount(tt.subtotal); got != tt.want {
+			t.Errorf("%s: Discount(%s) = %s, want %s", tt.name, tt.subtotal, got, tt.want)
+		}
+	}
+}
+
+func TestPromotionActiveAt(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		promotion Promotion
+		want      bool
+	}{
+		{"activa sin vigencia", Promotion{Active: true}, true},
+		{"inactiva", Promotion{Active: false}, false},
+		{"aún no empieza", Promotion{Active: true, StartsAt: &after}, false},
+		{"ya empezó", Promotion{Active: true, StartsAt: &before}, true},
+		{"empieza justo ahora", Promotion{Active: true, StartsAt: &now}, true},
+		{"ya terminó", Promotion{Active: true, EndsAt: &before}, false},
+		{"termina justo ahora", Promotion{Active: true, EndsAt: &now}, false},
+		{"dentro de la vigencia", Promotion{Active: true, StartsAt: &before, EndsAt: &after}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.promotion.ActiveAt(now); got != tt.want {
+			t.Errorf("%s: ActiveAt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
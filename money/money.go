@@ -0,0 +1,114 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Amount es un importe exacto expresado en centavos. Evita los errores de
+// redondeo de float64 al sumar precios.
+type Amount int64
+
+var ErrInvalid = errors.New("importe inválido: use un número con hasta 2 decimales")
+
+// Parse convierte "12", "12.5" o "12.50" en un Amount. Rechaza más de dos
+// decimales en lugar de redondear en silencio.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > 2 || strings.ContainsAny(whole+frac, "+-") {
+		return 0, ErrInvalid
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+
+	a := Amount(units*100 + cents)
+	if negative {
+		a = -a
+	}
+	return a, nil
+}
+
+// Mul multiplica el importe por una cantidad entera.
+func (a Amount) Mul(n int) Amount {
+	return a * Amount(n)
+}
+
+// MulRate aplica una tasa expresada en puntos básicos (1600 = 16%),
+// redondeando al centavo más cercano (medios hacia afuera de cero).
+func (a Amount) MulRate(bps int64) Amount {
+	product := int64(a) * bps
+	if product < 0 {
+		return -Amount((-product + 5000) / 10000)
+	}
+	return Amount((product + 5000) / 10000)
+}
+
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)
+}
+
+// MarshalJSON escribe el importe como número JSON con dos decimales.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON acepta tanto un número (12.50) como una cadena ("12.50"),
+// leyendo el texto literal para no pasar por float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan lee columnas DECIMAL, que el driver de MySQL entrega como texto.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		*a = parsed
+		return err
+	case string:
+		parsed, err := Parse(v)
+		*a = parsed
+		return err
+	case int64:
+		*a = Amount(v * 100)
+		return nil
+	default:
+		return fmt.Errorf("money: tipo no soportado %T", src)
+	}
+}
+
+// Value guarda el importe como texto decimal exacto.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
@@ -0,0 +1,128 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: "12", want: 1200},
+		{in: "12.5", want: 1250},
+		{in: "12.50", want: 1250},
+		{in: "0.01", want: 1},
+		{in: " 3.10 ", want: 310},
+		{in: "-4.25", want: -425},
+		{in: "12.345", wantErr: true},
+		{in: ".5", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1.-5", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "+1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if err != ErrInvalid {
+				t.Errorf("Parse(%q) error = %v, want ErrInvalid", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMulRate(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		bps    int64
+		want   Amount
+	}{
+		{amount: 10000, bps: 1600, want: 1600},
+		{amount: 1234, bps: 1600, want: 197}, // 197.44
+		{amount: 1250, bps: 1000, want: 125},
+		{amount: 5, bps: 1000, want: 1},   // 0.5 se redondea hacia afuera
+		{amount: -5, bps: 1000, want: -1}, // también en negativos
+		{amount: 999, bps: 10000, want: 999},
+		{amount: 1000, bps: 15000, want: 1500},
+		{amount: 0, bps: 1600, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.MulRate(tt.bps); got != tt.want {
+			t.Errorf("%d.MulRate(%d) = %d, want %d", tt.amount, tt.bps, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-425, "-4.25"},
+		{-5, "-0.05"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Price Amount `json:"price"`
+		Fee   Amount `json:"fee"`
+	}
+	if err := json.Unmarshal([]byte(`{"price": 19.99, "fee": "2.5"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Price != 1999 || v.Fee != 250 {
+		t.Fatalf("got price=%d fee=%d, want 1999 and 250", v.Price, v.Fee)
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"price":19.99,"fee":2.50}` {
+		t.Errorf("Marshal = %s", out)
+	}
+
+	if err := json.Unmarshal([]byte(`{"price": 0.001}`), &v); err == nil {
+		t.Error("se esperaba error con tres decimales")
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{nil, 0},
+		{[]byte("12.30"), 1230},
+		{"0.99", 99},
+		{int64(7), 700},
+	}
+	for _, tt := range tests {
+		var a Amount = 42
+		if err := a.Scan(tt.src); err != nil || a != tt.want {
+			t.Errorf("Scan(%v) = %d, %v; want %d", tt.src, a, err, tt.want)
+		}
+	}
+
+	var a Amount
+	if err := a.Scan(1.5); err == nil {
+		t.Error("Scan(float64) debería fallar")
+	}
+}
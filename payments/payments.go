@@ -0,0 +1,71 @@
+package payments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"deliveryService/money"
+)
+
+var (
+	ErrDeclined      = errors.New("Pago rechazado por el proveedor")
+	ErrInvalidAmount = errors.New("Importe de pago inválido")
+)
+
+// Provider abstrae a la pasarela de pagos. Authorize retiene el importe y
+// devuelve la referencia con la que se opera después; Capture cobra lo
+// retenido, Void libera la retención y Refund devuelve parte o todo lo
+// cobrado. El estado de cada pago se lleva en la tabla payments.
+type Provider interface {
+	Name() string
+	Authorize(amount money.Amount, reference string) (string, error)
+	Capture(authorizationId string, amount money.Amount) error
+	Void(authorizationId string) error
+	Refund(authorizationId string, amount money.Amount) (string, error)
+}
+
+// FakeProvider es una pasarela local para desarrollo. Aprueba todo salvo
+// los importes mayores que DeclineAbove (si es mayor que 0), lo que permite
+// probar el camino de rechazo sin una pasarela real.
+type FakeProvider struct {
+	DeclineAbove money.Amount
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(amount money.Amount, reference string) (string, error) {
+	if amount <= 0 {
+		return "", ErrInvalidAmount
+	}
+	if p.DeclineAbove > 0 && amount > p.DeclineAbove {
+		return "", ErrDeclined
+	}
+	return "fake_auth_" + randomId(), nil
+}
+
+func (p *FakeProvider) Capture(authorizationId string, amount money.Amount) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	return nil
+}
+
+func (p *FakeProvider) Void(authorizationId string) error {
+	return nil
+}
+
+func (p *FakeProvider) Refund(authorizationId string, amount money.Amount) (string, error) {
+	if amount <= 0 {
+		return "", ErrInvalidAmount
+	}
+	return "fake_refund_" + randomId(), nil
+}
+
+func randomId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,100 @@
+package pricing
+
+import (
+	"math"
+
+	"deliveryService/money"
+)
+
+// Config agrupa las tarifas. Las tasas van en puntos básicos (1600 = 16%).
+type Config struct {
+	BaseDeliveryFee money.Amount // tarifa de envío fija cuando la zona no define una
+	PerKmFee        money.Amount // cargo por kilómetro en línea recta
+	ServiceFeeBps   int64        // comisión de servicio sobre el subtotal
+	TaxBps          int64        // impuesto sobre subtotal con descuento, envío y servicio
+	SurgeRatio      float64      // órdenes pendientes por repartidor en línea que activan la tarifa dinámica
+	MaxSurgeBps     int64        // tope del multiplicador dinámico (20000 = 2x)
+}
+
+// Input reúne los datos de la orden necesarios para cotizar.
+type Input struct {
+	Subtotal   money.Amount
+	Discount   money.Amount  // descuento promocional sobre el subtotal
+	Tip        money.Amount  // propina para el repartidor, sin impuestos ni comisiones
+	DistanceKm *float64      // nil si faltan coordenadas
+	ZoneFee    *money.Amount // tarifa fija de la zona, si la tiene
+	Pending    int           // órdenes pendientes sin repartidor
+	Couriers   int           // repartidores en línea
+}
+
+// Breakdown es el desglose del precio. Total es lo que paga el cliente.
+type Breakdown struct {
+	Subtotal        money.Amount `json:"subtotal"`
+	Discount        money.Amount `json:"discount"`
+	DeliveryFee     money.Amount `json:"deliveryFee"`
+	ServiceFee      money.Amount `json:"serviceFee"`
+	Tax             money.Amount `json:"tax"`
+	SurgeMultiplier float64      `json:"surgeMultiplier"`
+	Tip             money.Amount `json:"tip"`
+	Total           money.Amount `json:"total"`
+}
+
+// SurgeBps devuelve el multiplicador de demanda en puntos básicos: 10000
+// (1x) mientras la relación pendientes/repartidores esté bajo SurgeRatio y
+// proporcional a ella por encima, hasta MaxSurgeBps.
+func (c Config) SurgeBps(pending, couriers int) int64 {
+	if c.SurgeRatio <= 0 || pending == 0 {
+		return 10000
+	}
+	if couriers < 1 {
+		couriers = 1
+	}
+	ratio := float64(pending) / float64(couriers)
+	if ratio < c.SurgeRatio {
+		return 10000
+	}
+	// Se redondea a décimas para que el multiplicador mostrado sea legible
+	bps := int64(math.Round(ratio/c.SurgeRatio*10)) * 1000
+	if bps < 10000 {
+		bps = 10000
+	}
+	if c.MaxSurgeBps > 0 && bps > c.MaxSurgeBps {
+		bps = c.MaxSurgeBps
+	}
+	return bps
+}
+
+// DeliveryFee calcula el envío antes de la tarifa dinámica. La tarifa de la
+// zona tiene prioridad; si no existe se cobra la base más la distancia.
+func (c Config) DeliveryFee(in Input) money.Amount {
+	if in.ZoneFee != nil {
+		return *in.ZoneFee
+	}
+	fee := c.BaseDeliveryFee
+	if in.DistanceKm != nil {
+		fee += money.Amount(math.Round(float64(c.PerKmFee) * *in.DistanceKm))
+	}
+	return fee
+}
+
+func (c Config) Quote(in Input) Breakdown {
+	surge := c.SurgeBps(in.Pending, in.Couriers)
+
+	// El descuento nunca deja el subtotal por debajo de cero
+	discount := in.Discount
+	if discount > in.Subtotal {
+		discount = in.Subtotal
+	}
+	b := Breakdown{
+		Subtotal:        in.Subtotal,
+		Discount:        discount,
+		DeliveryFee:     c.DeliveryFee(in).MulRate(surge),
+		ServiceFee:      in.Subtotal.MulRate(c.ServiceFeeBps),
+		SurgeMultiplier: float64(surge) / 10000,
+		Tip:             in.Tip,
+	}
+	net := b.Subtotal - b.Discount + b.DeliveryFee + b.ServiceFee
+	b.Tax = net.MulRate(c.TaxBps)
+	b.Total = net + b.Tax + b.Tip
+	return b
+}
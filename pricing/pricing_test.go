@@ -0,0 +1,99 @@
+package pricing
+
+import (
+	"testing"
+
+	"deliveryService/money"
+)
+
+var testConfig = Config{
+	BaseDeliveryFee: 2500,
+	PerKmFee:        500,
+	ServiceFeeBps:   500,
+	TaxBps:          1600,
+	SurgeRatio:      2,
+	MaxSurgeBps:     20000,
+}
+
+func TestSurgeBps(t *testing.T) {
+	tests := []struct {
+		name              string
+		pending, couriers int
+		want              int64
+	}{
+		{"sin pendientes", 0, 5, 10000},
+		{"bajo el umbral", 3, 2, 10000},
+		{"en el umbral", 4, 2, 10000},
+		{"sobre el umbral", 6, 2, 15000},
+		{"sin repartidores cuenta como uno", 3, 0, 15000},
+		{"limitado al máximo", 50, 1, 20000},
+	}
+	for _, tt := range tests {
+		if got := testConfig.SurgeBps(tt.pending, tt.couriers); got != tt.want {
+			t.Errorf("%s: SurgeBps(%d, %d) = %d, want %d", tt.name, tt.pending, tt.couriers, got, tt.want)
+		}
+	}
+
+	if got := (Config{}).SurgeBps(100, 1); got != 10000 {
+		t.Errorf("sin SurgeRatio la tarifa dinámica debe estar desactivada, got %d", got)
+	}
+}
+
+func TestDeliveryFee(t *testing.T) {
+	km := 3.2
+	zoneFee := money.Amount(1800)
+	tests := []struct {
+		name string
+		in   Input
+		want money.Amount
+	}{
+		{"sin distancia", Input{}, 2500},
+		{"con distancia", Input{DistanceKm: &km}, 2500 + 1600},
+		{"la zona tiene prioridad", Input{DistanceKm: &km, ZoneFee: &zoneFee}, 1800},
+	}
+	for _, tt := range tests {
+		if got := testConfig.DeliveryFee(tt.in); got != tt.want {
+			t.Errorf("%s: DeliveryFee = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Input
+		want Breakdown
+	}{
+		{
+			name: "sin descuento ni propina",
+			in:   Input{Subtotal: 10000},
+			// neto = 100 + 25 + 5 = 130; impuesto 16% = 20.80
+			want: Breakdown{Subtotal: 10000, DeliveryFee: 2500, ServiceFee: 500,
+				Tax: 2080, SurgeMultiplier: 1, Total: 15080},
+		},
+		{
+			name: "descuento y propina",
+			in:   Input{Subtotal: 10000, Discount: 2000, Tip: 300},
+			// neto = 80 + 25 + 5 = 110; la propina no paga impuestos
+			want: Breakdown{Subtotal: 10000, Discount: 2000, DeliveryFee: 2500, ServiceFee: 500,
+				Tax: 1760, SurgeMultiplier: 1, Tip: 300, Total: 11000 + 1760 + 300},
+		},
+		{
+			name: "el descuento no supera el subtotal",
+			in:   Input{Subtotal: 1000, Discount: 5000},
+			want: Breakdown{Subtotal: 1000, Discount: 1000, DeliveryFee: 2500, ServiceFee: 50,
+				Tax: 408, SurgeMultiplier: 1, Total: 2550 + 408},
+		},
+		{
+			name: "la tarifa dinámica solo afecta al envío",
+			in:   Input{Subtotal: 10000, Pending: 6, Couriers: 2},
+			want: Breakdown{Subtotal: 10000, DeliveryFee: 3750, ServiceFee: 500,
+				Tax: 2280, SurgeMultiplier: 1.5, Total: 14250 + 2280},
+		},
+	}
+	for _, tt := range tests {
+		if got := testConfig.Quote(tt.in); got != tt.want {
+			t.Errorf("%s:\n got  %+v\n want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package retention
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Purger elimina definitivamente los registros con borrado lógico cuya
+// antigüedad supera el periodo de retención.
+type Purger struct {
+	DB        *sql.DB
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+func (p *Purger) Start() {
+	go func() {
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+
+		for {
+			p.Purge()
+			<-ticker.C
+		}
+	}()
+}
+
+// Purge ejecuta cada paso por separado: el fallo de uno no impide los
+// demás.
+func (p *Purger) Purge() {
+	cutoff := time.Now().Add(-p.Retention)
+
+	// Primero las órdenes; al purgar usuarios el CASCADE elimina el resto
+	orders := p.purge("órdenes", "DELETE FROM orders WHERE deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+
+	// Se conservan los usuarios que aún tienen datos vigentes: el CASCADE
+	// borraría las órdenes de un cliente, las ganancias, liquidaciones y
+	// lotes de un repartidor (dejando el libro contable sin respaldo) o los
+	// establecimientos de un propietario con su menú y plantillas
+	users := p.purge("usuarios",
+		`DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?
+		 AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = users.id AND o.deleted_at IS NULL)
+		 AND NOT EXISTS (SELECT 1 FROM courier_earnings e WHERE e.courier_id = users.id)
+		 AND NOT EXISTS (SELECT 1 FROM payouts po WHERE po.courier_id = users.id)
+		 AND NOT EXISTS (SELECT 1 FROM delivery_batches b WHERE b.delivery_id = users.id)
+		 AND NOT EXISTS (SELECT 1 FROM establishments es WHERE es.owner_id = users.id)`,
+		cutoff,
+	)
+
+	if orders > 0 || users > 0 {
+		log.Printf("Purga completada: %d órdenes y %d usuarios eliminados", orders, users)
+	}
+
+	// Las claves de idempotencia tienen su propia caducidad
+	p.purge("claves de idempotencia", "DELETE FROM idempotency_keys WHERE expires_at < ?", time.Now())
+}
+
+// purge ejecuta un DELETE y devuelve las filas eliminadas; los errores se
+// registran en el log.
+func (p *Purger) purge(what, query string, args ...interface{}) int64 {
+	result, err := p.DB.Exec(query, args...)
+	if err != nil {
+		log.Printf("Error purgando %s: %v", what, err)
+		return 0
+	}
+	n, _ := result.RowsAffected()
+	return n
+}
@@ -0,0 +1,89 @@
+package routing
+
+import "deliveryService/geo"
+
+// Stop es una parada de entrega de la ruta.
+type Stop struct {
+	OrderID  int
+	Location *geo.Point
+}
+
+// Plan ordena las paradas partiendo de start con la heurística del vecino
+// más cercano y luego la mejora con 2-opt. La ruta es abierta: no vuelve al
+// origen. Las paradas sin coordenadas se dejan al final, en su orden.
+func Plan(start *geo.Point, stops []Stop) []Stop {
+	var located, unlocated []Stop
+	for _, s := range stops {
+		if s.Location != nil {
+			located = append(located, s)
+		} else {
+			unlocated = append(unlocated, s)
+		}
+	}
+
+	route := nearestNeighbour(start, located)
+	route = twoOpt(start, route)
+	return append(route, unlocated...)
+}
+
+func nearestNeighbour(start *geo.Point, stops []Stop) []Stop {
+	remaining := append([]Stop{}, stops...)
+	route := make([]Stop, 0, len(stops))
+
+	current := start
+	for len(remaining) > 0 {
+		best := 0
+		if current != nil {
+			for i := range remaining {
+				if geo.DistanceKm(*current, *remaining[i].Location) < geo.DistanceKm(*current, *remaining[best].Location) {
+					best = i
+				}
+			}
+		}
+		route = append(route, remaining[best])
+		current = remaining[best].Location
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return route
+}
+
+// twoOpt invierte tramos de la ruta mientras eso acorte el recorrido total.
+func twoOpt(start *geo.Point, route []Stop) []Stop {
+	best := Length(start, route)
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(route)-1; i++ {
+			for j := i + 1; j < len(route); j++ {
+				candidate := append([]Stop{}, route...)
+				reverse(candidate[i : j+1])
+				if length := Length(start, candidate); length < best-1e-9 {
+					route, best, improved = candidate, length, true
+				}
+			}
+		}
+	}
+	return route
+}
+
+func reverse(stops []Stop) {
+	for i, j := 0, len(stops)-1; i < j; i, j = i+1, j-1 {
+		stops[i], stops[j] = stops[j], stops[i]
+	}
+}
+
+// Length devuelve la distancia total en km desde start recorriendo las
+// paradas con coordenadas en orden.
+func Length(start *geo.Point, route []Stop) float64 {
+	total := 0.0
+	prev := start
+	for _, s := range route {
+		if s.Location == nil {
+			continue
+		}
+		if prev != nil {
+			total += geo.DistanceKm(*prev, *s.Location)
+		}
+		prev = s.Location
+	}
+	return total
+}
@@ -0,0 +1,109 @@
+package routing
+
+import (
+	"math"
+	"testing"
+
+	"deliveryService/geo"
+)
+
+func point(lat, lng float64) *geo.Point {
+	return &geo.Point{Lat: lat, Lng: lng}
+}
+
+func orderIDs(route []Stop) []int {
+	ids := make([]int, len(route))
+	for i, s := range route {
+		ids[i] = s.OrderID
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPlan(t *testing.T) {
+	start := point(0, 0)
+	tests := []struct {
+		name  string
+		start *geo.Point
+		stops []Stop
+		want  []int
+	}{
+		{
+			name:  "sin paradas",
+			start: start,
+			want:  []int{},
+		},
+		{
+			name:  "paradas en línea desordenadas",
+			start: start,
+			stops: []Stop{{3, point(0, 0.03)}, {1, point(0, 0.01)}, {2, point(0, 0.02)}},
+			want:  []int{1, 2, 3},
+		},
+		{
+			name:  "las paradas sin coordenadas van al final en su orden",
+			start: start,
+			stops: []Stop{{9, nil}, {2, point(0, 0.02)}, {8, nil}, {1, point(0, 0.01)}},
+			want:  []int{1, 2, 9, 8},
+		},
+		{
+			name:  "sin origen se mantiene la primera parada",
+			start: nil,
+			stops: []Stop{{1, point(0, 0.01)}, {2, point(0, 0.02)}},
+			want:  []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		got := orderIDs(Plan(tt.start, tt.stops))
+		if !equalIDs(got, tt.want) {
+			t.Errorf("%s: Plan = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// El vecino más cercano va primero a la parada 1, luego a la 2 y a la 4, y
+// tiene que volver a por la 3; 2-opt empieza por la 3 y ahorra casi 5 km.
+func TestPlanImprovesNearestNeighbour(t *testing.T) {
+	start := point(0, 0)
+	stops := []Stop{
+		{1, point(-0.03, 0.01)},
+		{2, point(-0.02, 0.03)},
+		{3, point(-0.03, -0.02)},
+		{4, point(0.03, 0.03)},
+	}
+
+	greedy := nearestNeighbour(start, stops)
+	if got := orderIDs(greedy); !equalIDs(got, []int{1, 2, 4, 3}) {
+		t.Fatalf("nearestNeighbour = %v, want [1 2 4 3]", got)
+	}
+	route := Plan(start, stops)
+	if got := orderIDs(route); !equalIDs(got, []int{3, 1, 2, 4}) {
+		t.Fatalf("Plan = %v, want [3 1 2 4]", got)
+	}
+	if Length(start, route) >= Length(start, greedy) {
+		t.Errorf("2-opt no acortó la ruta: %.3f km frente a %.3f km", Length(start, route), Length(start, greedy))
+	}
+}
+
+func TestLength(t *testing.T) {
+	start := point(0, 0)
+	route := []Stop{{1, point(0, 1)}, {2, nil}, {3, point(0, 2)}}
+
+	want := 2 * geo.DistanceKm(geo.Point{}, geo.Point{Lng: 1})
+	if got := Length(start, route); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Length = %f, want %f", got, want)
+	}
+	if got := Length(nil, route[:1]); got != 0 {
+		t.Errorf("Length sin origen y una parada = %f, want 0", got)
+	}
+}
@@ -7,18 +7,22 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
+	"deliveryService/apierror"
 	"deliveryService/models"
 )
 
 type SSEManager struct {
-	clients map[int]chan []byte
-	mu      sync.RWMutex
+	clients        map[int]chan []byte
+	disconnectedAt map[int]time.Time
+	mu             sync.RWMutex
 }
 
 func NewSSEManager() *SSEManager {
 	return &SSEManager{
-		clients: make(map[int]chan []byte),
+		clients:        make(map[int]chan []byte),
+		disconnectedAt: make(map[int]time.Time),
 	}
 }
 
@@ -28,6 +32,7 @@ func (m *SSEManager) RegisterClient(userId int) chan []byte {
 
 	ch := make(chan []byte, 10)
 	m.clients[userId] = ch
+	delete(m.disconnectedAt, userId)
 	log.Printf("Cliente %d registrado para SSE", userId)
 	return ch
 }
@@ -39,10 +44,35 @@ func (m *SSEManager) UnregisterClient(userId int) {
 	if ch, exists := m.clients[userId]; exists {
 		close(ch)
 		delete(m.clients, userId)
+		m.disconnectedAt[userId] = time.Now()
 		log.Printf("Cliente %d desconectado de SSE", userId)
 	}
 }
 
+func (m *SSEManager) IsConnected(userId int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, exists := m.clients[userId]
+	return exists
+}
+
+// ExpiredDisconnections devuelve los usuarios que llevan desconectados más
+// de grace y deja de seguirlos, de modo que cada uno se reporta una sola vez.
+func (m *SSEManager) ExpiredDisconnections(grace time.Duration) []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []int
+	for userId, at := range m.disconnectedAt {
+		if time.Since(at) > grace {
+			expired = append(expired, userId)
+			delete(m.disconnectedAt, userId)
+		}
+	}
+	return expired
+}
+
 func (m *SSEManager) NotifyUser(userId int, event string, data interface{}) error {
 	m.mu.RLock()
 	ch, exists := m.clients[userId]
@@ -111,13 +141,13 @@ func (m *SSEManager) Broadcast(event string, data interface{}) {
 func (m *SSEManager) SSEHandler(w http.ResponseWriter, r *http.Request) {
 	userIdStr := r.URL.Query().Get("userId")
 	if userIdStr == "" {
-		http.Error(w, "Se requiere userId en la query string", http.StatusBadRequest)
+		apierror.Error(w, "Se requiere userId en la query string", http.StatusBadRequest)
 		return
 	}
 
 	userId, err := strconv.Atoi(userIdStr)
 	if err != nil {
-		http.Error(w, "userId debe ser un número válido", http.StatusBadRequest)
+		apierror.Error(w, "userId debe ser un número válido", http.StatusBadRequest)
 		return
 	}
 
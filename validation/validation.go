@@ -0,0 +1,263 @@
+// Package validation valida los DTOs de las peticiones a partir de la
+// etiqueta `validate` de sus campos y decodifica cuerpos JSON de forma
+// estricta.
+//
+// Reglas admitidas, separadas por comas:
+//
+//	required      el valor no puede ser vacío, cero ni nil; en los punteros
+//	              basta con que no sea nil, así 0 o "" cuentan como enviados
+//	min=N, max=N  longitud para textos y listas, valor para números
+//	gt=N          el número debe ser mayor que N
+//	oneof=a b c   el texto debe ser uno de los valores
+//	clock         el texto debe tener formato "HH:MM"
+//
+// Las reglas distintas de required se omiten en valores vacíos y punteros
+// nil. Los structs anidados, punteros a struct y listas de structs se
+// validan recursivamente.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxBodyBytes es el tamaño máximo de un cuerpo JSON.
+const MaxBodyBytes = 1 << 20
+
+// FieldError describe un campo inválido con su ruta JSON (p.ej.
+// "items[0].quantity").
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors reúne todos los campos inválidos de una petición.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+var (
+	// ErrEmptyBody indica que la petición no trae cuerpo.
+	ErrEmptyBody = errors.New("Se requiere un cuerpo JSON")
+	// ErrBodyTooLarge indica que el cuerpo supera MaxBodyBytes.
+	ErrBodyTooLarge = errors.New("Cuerpo de la petición demasiado grande")
+	// ErrMalformed indica que el cuerpo no es JSON válido.
+	ErrMalformed = errors.New("JSON inválido")
+	// ErrInvalidTime indica una fecha que no sigue RFC 3339.
+	ErrInvalidTime = errors.New("Fecha inválida, se esperaba formato RFC 3339")
+)
+
+// Decode lee el cuerpo en dst rechazando campos desconocidos y cuerpos de
+// más de MaxBodyBytes, y después valida dst. Los errores por campo se
+// devuelven como Errors.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		var typeErr *json.UnmarshalTypeError
+		var timeErr *time.ParseError
+		switch {
+		case err == io.EOF:
+			return ErrEmptyBody
+		case errors.As(err, &tooLarge):
+			return ErrBodyTooLarge
+		case errors.As(err, &typeErr):
+			return Errors{{Field: typeErr.Field, Message: "tipo inválido, se esperaba " + typeErr.Type.String()}}
+		case errors.As(err, &timeErr):
+			return ErrInvalidTime
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return Errors{{Field: field, Message: "campo desconocido"}}
+		case errors.As(err, new(*json.SyntaxError)) || err == io.ErrUnexpectedEOF:
+			return ErrMalformed
+		default:
+			// Errores de los tipos con UnmarshalJSON propio, como money.Amount
+			return errors.New("JSON inválido: " + err.Error())
+		}
+	}
+	if decoder.More() {
+		return ErrMalformed
+	}
+
+	if errs := Struct(dst); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Struct valida v (struct o puntero a struct) y devuelve todos los campos
+// que incumplen sus reglas.
+func Struct(v interface{}) Errors {
+	var errs Errors
+	walk(reflect.ValueOf(v), "", &errs)
+	return errs
+}
+
+func walk(v reflect.Value, path string, errs *Errors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name, skip := jsonName(field)
+			if skip {
+				continue
+			}
+			fieldPath := path
+			// Los structs embebidos comparten la ruta del que los contiene
+			if !field.Anonymous {
+				fieldPath = join(path, name)
+			}
+			value := v.Field(i)
+			if tag := field.Tag.Get("validate"); tag != "" {
+				checkField(value, fieldPath, tag, errs)
+			}
+			walk(value, fieldPath, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	}
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, false
+	}
+	return field.Name, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func checkField(v reflect.Value, path, tag string, errs *Errors) {
+	rules := strings.Split(tag, ",")
+	pointer := v.Kind() == reflect.Ptr
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			for _, rule := range rules {
+				if rule == "required" {
+					*errs = append(*errs, FieldError{path, "es requerido"})
+				}
+			}
+			return
+		}
+		v = v.Elem()
+	}
+
+	empty := v.IsZero()
+	if v.Kind() == reflect.String {
+		empty = strings.TrimSpace(v.String()) == ""
+	} else if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		empty = v.Len() == 0
+	}
+
+	for _, rule := range rules {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		if name == "required" {
+			if empty && !pointer {
+				*errs = append(*errs, FieldError{path, "es requerido"})
+				return
+			}
+			continue
+		}
+		if empty && (v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map) {
+			continue
+		}
+		if message := checkRule(v, name, arg); message != "" {
+			*errs = append(*errs, FieldError{path, message})
+			return
+		}
+	}
+}
+
+// checkRule devuelve el mensaje de error de la regla, o "" si se cumple.
+func checkRule(v reflect.Value, name, arg string) string {
+	switch name {
+	case "min", "max", "gt":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic("validation: límite inválido en la regla " + name + "=" + arg)
+		}
+		size, unit := measure(v)
+		switch {
+		case name == "min" && size < limit:
+			return fmt.Sprintf("debe ser como mínimo %s%s", arg, unit)
+		case name == "max" && size > limit:
+			return fmt.Sprintf("debe ser como máximo %s%s", arg, unit)
+		case name == "gt" && size <= limit:
+			return fmt.Sprintf("debe ser mayor que %s", arg)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if v.String() == option {
+				return ""
+			}
+		}
+		return "debe ser uno de: " + strings.Join(options, ", ")
+	case "clock":
+		if _, err := time.Parse("15:04", v.String()); err != nil || len(v.String()) != 5 {
+			return "debe tener formato HH:MM"
+		}
+	default:
+		panic("validation: regla desconocida " + name)
+	}
+	return ""
+}
+
+// measure devuelve el tamaño que comparan min, max y gt: longitud en
+// caracteres para textos, elementos para listas y el valor para números.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " caracteres"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " elementos"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic("validation: tipo no comparable " + v.Kind().String())
+}
@@ -0,0 +1,141 @@
+package validation
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testItem struct {
+	MenuItemID int `json:"menuItemId" validate:"required"`
+	Quantity   int `json:"quantity" validate:"min=1,max=99"`
+}
+
+type testAddress struct {
+	Street string `json:"street" validate:"required,max=10"`
+}
+
+type testRequest struct {
+	Name     string       `json:"name" validate:"required,max=5"`
+	Role     string       `json:"role,omitempty" validate:"oneof=customer delivery"`
+	Price    int64        `json:"price" validate:"gt=0"`
+	Time     string       `json:"time,omitempty" validate:"clock"`
+	Tags     []string     `json:"tags,omitempty" validate:"max=2"`
+	Tip      *int         `json:"tip,omitempty" validate:"min=0"`
+	Address  *testAddress `json:"address,omitempty"`
+	Billing  *testAddress `json:"billing,omitempty" validate:"required"`
+	Items    []testItem   `json:"items" validate:"required"`
+	internal string       `validate:"required"`
+	Ignored  string       `json:"-" validate:"required"`
+}
+
+func valid() testRequest {
+	return testRequest{
+		Name:    "Ana",
+		Price:   100,
+		Billing: &testAddress{Street: "Reforma"},
+		Items:   []testItem{{MenuItemID: 1, Quantity: 1}},
+	}
+}
+
+func TestStruct(t *testing.T) {
+	negative, zero := -1, 0
+	tests := []struct {
+		name   string
+		modify func(r *testRequest)
+		want   Errors
+	}{
+		{"válido", func(r *testRequest) {}, nil},
+		{"requerido vacío", func(r *testRequest) { r.Name = "" }, Errors{{"name", "es requerido"}}},
+		{"requerido solo espacios", func(r *testRequest) { r.Name = "   " }, Errors{{"name", "es requerido"}}},
+		{"max en caracteres", func(r *testRequest) { r.Name = "Añañañ" }, Errors{{"name", "debe ser como máximo 5 caracteres"}}},
+		{"max en caracteres multibyte", func(r *testRequest) { r.Name = "ñññññ" }, nil},
+		{"oneof", func(r *testRequest) { r.Role = "admin" }, Errors{{"role", "debe ser uno de: customer, delivery"}}},
+		{"gt con cero", func(r *testRequest) { r.Price = 0 }, Errors{{"price", "debe ser mayor que 0"}}},
+		{"clock válido", func(r *testRequest) { r.Time = "23:59" }, nil},
+		{"clock fuera de rango", func(r *testRequest) { r.Time = "24:00" }, Errors{{"time", "debe tener formato HH:MM"}}},
+		{"clock sin cero inicial", func(r *testRequest) { r.Time = "9:30" }, Errors{{"time", "debe tener formato HH:MM"}}},
+		{"max en elementos", func(r *testRequest) { r.Tags = []string{"a", "b", "c"} }, Errors{{"tags", "debe ser como máximo 2 elementos"}}},
+		{"min sobre puntero", func(r *testRequest) { r.Tip = &negative }, Errors{{"tip", "debe ser como mínimo 0"}}},
+		{"puntero a cero", func(r *testRequest) { r.Tip = &zero }, nil},
+		{"struct anidado opcional", func(r *testRequest) { r.Address = &testAddress{} }, Errors{{"address.street", "es requerido"}}},
+		{"puntero requerido nil", func(r *testRequest) { r.Billing = nil }, Errors{{"billing", "es requerido"}}},
+		{"lista requerida vacía", func(r *testRequest) { r.Items = []testItem{} }, Errors{{"items", "es requerido"}}},
+		{
+			"ruta de elementos de la lista",
+			func(r *testRequest) { r.Items = append(r.Items, testItem{Quantity: 100}) },
+			Errors{{"items[1].menuItemId", "es requerido"}, {"items[1].quantity", "debe ser como máximo 99"}},
+		},
+		{
+			"varios errores a la vez",
+			func(r *testRequest) { r.Name, r.Price, r.Items[0].Quantity = "", -5, 0 },
+			Errors{{"name", "es requerido"}, {"price", "debe ser mayor que 0"}, {"items[0].quantity", "debe ser como mínimo 1"}},
+		},
+	}
+	for _, tt := range tests {
+		r := valid()
+		tt.modify(&r)
+		if got := Struct(&r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Struct = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if errs := Struct((*testRequest)(nil)); errs != nil {
+		t.Errorf("Struct(nil) = %v, want nil", errs)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"válido", `{"name": "Ana", "price": 100, "billing": {"street": "Reforma"}, "items": [{"menuItemId": 1, "quantity": 2}]}`, nil},
+		{"sin cuerpo", ``, ErrEmptyBody},
+		{"JSON mal formado", `{"name": `, ErrMalformed},
+		{"dos documentos", `{} {}`, ErrMalformed},
+		{"campo desconocido", `{"name": "Ana", "extra": 1}`, Errors{{"extra", "campo desconocido"}}},
+		{"tipo inválido", `{"price": "100"}`, Errors{{"price", "tipo inválido, se esperaba int64"}}},
+		{
+			"errores de validación",
+			`{"name": "Ana", "price": 100, "billing": {"street": "Reforma"}, "items": [{"quantity": 1}]}`,
+			Errors{{"items[0].menuItemId", "es requerido"}},
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		var dst testRequest
+		if got := Decode(httptest.NewRecorder(), r, &dst); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Decode = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "`+strings.Repeat("a", MaxBodyBytes)+`"}`))
+	var dst testRequest
+	if err := Decode(httptest.NewRecorder(), r, &dst); err != ErrBodyTooLarge {
+		t.Errorf("cuerpo grande: Decode = %v, want ErrBodyTooLarge", err)
+	}
+}
+
+func TestStructRequiredPointer(t *testing.T) {
+	type ping struct {
+		Lat *float64 `json:"lat" validate:"required,min=-90,max=90"`
+	}
+	zero, outOfRange := 0.0, 91.0
+	tests := []struct {
+		name string
+		lat  *float64
+		want Errors
+	}{
+		{"ausente", nil, Errors{{"lat", "es requerido"}}},
+		{"cero es un valor enviado", &zero, nil},
+		{"las demás reglas se aplican", &outOfRange, Errors{{"lat", "debe ser como máximo 90"}}},
+	}
+	for _, tt := range tests {
+		if got := Struct(ping{Lat: tt.lat}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Struct = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
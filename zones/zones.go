@@ -0,0 +1,66 @@
+package zones
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"deliveryService/geo"
+	"deliveryService/models"
+)
+
+const Columns = "id, name, kind, polygon, center_lat, center_lng, radius_km, active, delivery_fee"
+
+func Scan(row interface{ Scan(...interface{}) error }, zone *models.Zone) error {
+	var polygon sql.NullString
+	var lat, lng, radius sql.NullFloat64
+	err := row.Scan(&zone.ID, &zone.Name, &zone.Kind, &polygon, &lat, &lng, &radius, &zone.Active, &zone.DeliveryFee)
+	if err != nil {
+		return err
+	}
+	if polygon.Valid {
+		if err := json.Unmarshal([]byte(polygon.String), &zone.Polygon); err != nil {
+			return err
+		}
+	}
+	if lat.Valid && lng.Valid {
+		zone.Center = &geo.Point{Lat: lat.Float64, Lng: lng.Float64}
+	}
+	zone.RadiusKm = radius.Float64
+	return nil
+}
+
+// LoadActive devuelve las zonas activas, en orden de creación.
+func LoadActive(db *sql.DB) ([]models.Zone, error) {
+	rows, err := db.Query("SELECT " + Columns + " FROM delivery_zones WHERE active = TRUE ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zones []models.Zone
+	for rows.Next() {
+		var zone models.Zone
+		if err := Scan(rows, &zone); err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+	return zones, rows.Err()
+}
+
+// Find devuelve la primera zona que contiene todos los puntos, o nil.
+func Find(zones []models.Zone, points ...geo.Point) *models.Zone {
+	for i := range zones {
+		covered := true
+		for _, p := range points {
+			if !zones[i].Contains(p) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return &zones[i]
+		}
+	}
+	return nil
+}